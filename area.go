@@ -0,0 +1,81 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+)
+
+const AREA_DEFAULT_HOURS = 24
+
+// AreaVisit is a continuous period a ship was observed inside an area.
+// Entry and Exit are the first and last positions observed inside, so a ship may have entered or left up to one report interval earlier or later.
+type AreaVisit struct {
+	MMSI   int    `json:"mmsi"`
+	Name   string `json:"name"`
+	Entry  int64  `json:"entry"`
+	Exit   int64  `json:"exit"`
+	Points int    `json:"points"`
+}
+
+// GetAreaVisits returns every visit to polygon, a ring of lat, lon vertices, between from and to using the track store.
+// Visits are ordered by entry time.
+func (s *Ships) GetAreaVisits(polygon [][]float64, from int64, to int64, ts *TrackStore) ([]AreaVisit, error) {
+	if len(polygon) < 3 {
+		return nil, fmt.Errorf("polygon must have at least 3 vertices")
+	}
+
+	bbox := polygonBbox(polygon)
+	if !validBbox(bbox) {
+		return nil, fmt.Errorf("polygon out of range")
+	}
+
+	tracks, err := ts.QueryArea(bbox, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	visits := make([]AreaVisit, 0)
+	for mmsi, track := range tracks {
+		visits = append(visits, areaVisits(mmsi, track, polygon)...)
+	}
+
+	s.StateLock.RLock()
+	for i := range visits {
+		if ship, ok := s.State[visits[i].MMSI]; ok {
+			visits[i].Name = ship.Name
+		}
+	}
+	s.StateLock.RUnlock()
+
+	slices.SortFunc(visits, func(a, b AreaVisit) int {
+		if c := cmp.Compare(a.Entry, b.Entry); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.MMSI, b.MMSI)
+	})
+
+	return visits, nil
+}
+
+// areaVisits splits a track, ordered oldest first, into the runs of positions inside polygon.
+func areaVisits(mmsi int, track []History, polygon [][]float64) []AreaVisit {
+	visits := []AreaVisit{}
+
+	var visit *AreaVisit
+	for _, h := range track {
+		if !pointInPolygon(h.LatLon, polygon) {
+			visit = nil
+			continue
+		}
+
+		if visit == nil {
+			visits = append(visits, AreaVisit{MMSI: mmsi, Entry: h.Timestamp})
+			visit = &visits[len(visits)-1]
+		}
+		visit.Exit = h.Timestamp
+		visit.Points++
+	}
+
+	return visits
+}
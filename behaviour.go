@@ -0,0 +1,306 @@
+package main
+
+import (
+	"slices"
+	"time"
+)
+
+const (
+	TAG_LOITERING       = "loitering"
+	TAG_COURSE_REVERSAL = "courseReversal"
+	TAG_SPEED_ANOMALY   = "speedAnomaly"
+
+	SOG_NOT_AVAILABLE = 102.3
+	COG_NOT_AVAILABLE = 360
+)
+
+// Behaviour periodically evaluates ship state and history for anomalous behaviour.
+// Detected anomalies are attached to State as tags and cleared once the behaviour stops.
+type Behaviour struct {
+	Enable     bool            `json:"enable"`
+	Timer      int             `json:"timer"`
+	Loiter     Loiter          `json:"loiter"`
+	Reversal   Reversal        `json:"reversal"`
+	SpeedLimit map[int]float64 `json:"speedLimit"`
+	Anchorages [][2][2]float64 `json:"anchorages"`
+	courses    map[int]courseSample
+	reversals  map[int]int64
+	Quit       chan struct{}
+	Done       chan struct{}
+}
+
+// Loiter flags ships that remain below MaxSpeed within RadiusNm of their current position for at least Minutes.
+type Loiter struct {
+	MaxSpeed float64 `json:"maxSpeed"`
+	RadiusNm float64 `json:"radiusNm"`
+	Minutes  int     `json:"minutes"`
+}
+
+// Reversal flags ships above MinSpeed whose course changes by at least MinDegrees within WindowSeconds.
+// The tag is held for HoldMinutes after the reversal is observed.
+type Reversal struct {
+	MinDegrees    float64 `json:"minDegrees"`
+	MinSpeed      float64 `json:"minSpeed"`
+	WindowSeconds int     `json:"windowSeconds"`
+	HoldMinutes   int     `json:"holdMinutes"`
+}
+
+type courseSample struct {
+	COG       float64
+	Timestamp int64
+}
+
+// Anomaly is returned by the anomalies endpoint for every ship carrying at least one tag.
+type Anomaly struct {
+	MMSI       int       `json:"mmsi"`
+	Name       string    `json:"name"`
+	LatLon     []float64 `json:"latlon"`
+	SOG        float64   `json:"sog"`
+	ShipType   int       `json:"shipType"`
+	Tags       []string  `json:"tags"`
+	LastUpdate int64     `json:"lastUpdate"`
+}
+
+type behaviourSample struct {
+	LatLon     []float64
+	SOG        float64
+	COG        float64
+	NavStatus  int
+	ShipType   int
+	LastUpdate int64
+}
+
+func NewBehaviour(b Behaviour) *Behaviour {
+	b.courses = map[int]courseSample{}
+	b.reversals = map[int]int64{}
+	b.Quit = make(chan struct{})
+	b.Done = make(chan struct{})
+	return &b
+}
+
+func NewBehaviourDefaults() *Behaviour {
+	return &Behaviour{
+		Enable: true,
+		Timer:  60,
+		Loiter: Loiter{
+			MaxSpeed: 1.0,
+			RadiusNm: 1.0,
+			Minutes:  180,
+		},
+		Reversal: Reversal{
+			MinDegrees:    150,
+			MinSpeed:      3,
+			WindowSeconds: 300,
+			HoldMinutes:   30,
+		},
+		SpeedLimit: map[int]float64{
+			0: 30, // Cargo
+			7: 25, // Tanker
+		},
+		courses:   map[int]courseSample{},
+		reversals: map[int]int64{},
+		Quit:      make(chan struct{}),
+		Done:      make(chan struct{}),
+	}
+}
+
+func (b *Behaviour) Detect(d *Dock) {
+	if !b.Enable || b.Timer < 1 {
+		<-b.Quit
+		b.Done <- struct{}{}
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(b.Timer) * time.Second)
+
+	for {
+		select {
+		case <-b.Quit:
+			b.Done <- struct{}{}
+			return
+		case <-ticker.C:
+			b.evaluate(d.Ships, d.Events, d.Voyage.PortRadiusNm)
+		}
+	}
+}
+
+// evaluate samples ship state under a read lock, derives tags for every ship, then writes the tags back.
+// Tags a ship did not already carry are published as alerts. Ships within portRadiusNm of a port are not considered loitering.
+func (b *Behaviour) evaluate(s *Ships, events *EventBus, portRadiusNm float64) {
+	now := time.Now().UTC().Unix()
+
+	samples := make(map[int]behaviourSample)
+	s.StateLock.RLock()
+	for mmsi, ship := range s.State {
+		samples[mmsi] = behaviourSample{
+			LatLon:     ship.LatLon,
+			SOG:        ship.SOG,
+			COG:        ship.COG,
+			NavStatus:  ship.NavStatus,
+			ShipType:   ship.ShipType,
+			LastUpdate: ship.LastUpdate,
+		}
+	}
+	s.StateLock.RUnlock()
+
+	tags := make(map[int][]string)
+	for mmsi, sample := range samples {
+		var t []string
+
+		if b.loitering(s, mmsi, sample, now, portRadiusNm) {
+			t = append(t, TAG_LOITERING)
+		}
+
+		if b.courseReversal(mmsi, sample, now) {
+			t = append(t, TAG_COURSE_REVERSAL)
+		}
+
+		if b.speedAnomaly(sample) {
+			t = append(t, TAG_SPEED_ANOMALY)
+		}
+
+		tags[mmsi] = t
+	}
+
+	// Forget course samples and reversals for ships removed since the last evaluation.
+	for mmsi := range b.courses {
+		if _, ok := samples[mmsi]; !ok {
+			delete(b.courses, mmsi)
+			delete(b.reversals, mmsi)
+		}
+	}
+
+	alerts := []Event{}
+
+	s.StateLock.Lock()
+	for mmsi, t := range tags {
+		if ship, ok := s.State[mmsi]; ok && !slices.Equal(ship.Tags, t) {
+			for _, tag := range newTags(ship.Tags, t) {
+				alerts = append(alerts, Event{Type: EVENT_ALERT, MMSI: mmsi, Name: ship.Name, LatLon: ship.LatLon, Timestamp: now, Alert: tag})
+			}
+			ship.Tags = t
+			s.touch(ship)
+		}
+	}
+	s.StateLock.Unlock()
+
+	for _, e := range alerts {
+		events.Publish(e)
+	}
+}
+
+// loitering walks the ship's history from newest to oldest and determines how long the ship has remained within the loiter radius.
+// Ships at anchor, moored or aground, inside a configured anchorage or within portRadiusNm of a port are never considered loitering.
+func (b *Behaviour) loitering(s *Ships, mmsi int, sample behaviourSample, now int64, portRadiusNm float64) bool {
+	if b.Loiter.Minutes < 1 || sample.SOG > b.Loiter.MaxSpeed || len(sample.LatLon) != 2 {
+		return false
+	}
+
+	if sample.NavStatus == 1 || sample.NavStatus == 5 || sample.NavStatus == 6 {
+		return false
+	}
+
+	if now-sample.LastUpdate > int64(b.Loiter.Minutes*60) {
+		return false
+	}
+
+	for _, anchorage := range b.Anchorages {
+		if inBbox(sample.LatLon, anchorage) {
+			return false
+		}
+	}
+
+	if nearestPort(sample.LatLon, portRadiusNm) != "" {
+		return false
+	}
+
+	s.HistoryLock.RLock()
+	defer s.HistoryLock.RUnlock()
+
+	// The ship may have been removed by swabby since the sample was taken.
+	history, ok := s.History[mmsi]
+	if !ok {
+		return false
+	}
+
+	since := now
+	for _, h := range history.Points() {
+		if distanceNm(sample.LatLon, h.LatLon) > b.Loiter.RadiusNm {
+			break
+		}
+		since = h.Timestamp
+	}
+
+	return now-since >= int64(b.Loiter.Minutes*60)
+}
+
+// courseReversal compares the current course over ground against a sample taken within the reversal window.
+// The stored sample is dropped when speed or course is not available, so no reversal is measured across the gap.
+func (b *Behaviour) courseReversal(mmsi int, sample behaviourSample, now int64) bool {
+	if b.Reversal.MinDegrees <= 0 {
+		return false
+	}
+
+	if sample.SOG >= b.Reversal.MinSpeed && sample.SOG < SOG_NOT_AVAILABLE && sample.COG < COG_NOT_AVAILABLE {
+		prev, ok := b.courses[mmsi]
+		if !ok || now-prev.Timestamp > int64(b.Reversal.WindowSeconds) {
+			b.courses[mmsi] = courseSample{COG: sample.COG, Timestamp: now}
+		} else if angleDiff(sample.COG, prev.COG) >= b.Reversal.MinDegrees {
+			b.reversals[mmsi] = now
+			b.courses[mmsi] = courseSample{COG: sample.COG, Timestamp: now}
+		}
+	} else {
+		delete(b.courses, mmsi)
+	}
+
+	if ts, ok := b.reversals[mmsi]; ok {
+		if now-ts <= int64(b.Reversal.HoldMinutes*60) {
+			return true
+		}
+		delete(b.reversals, mmsi)
+	}
+
+	return false
+}
+
+// speedAnomaly flags ships travelling faster than the limit configured for their ship group.
+func (b *Behaviour) speedAnomaly(sample behaviourSample) bool {
+	if sample.SOG >= SOG_NOT_AVAILABLE {
+		return false
+	}
+
+	shipType, ok := ShipTypes[sample.ShipType]
+	if !ok {
+		return false
+	}
+
+	limit, ok := b.SpeedLimit[shipType.GroupId]
+	if !ok || limit <= 0 {
+		return false
+	}
+
+	return sample.SOG > limit
+}
+
+func (s *Ships) GetAnomalies() []Anomaly {
+	s.StateLock.RLock()
+	defer s.StateLock.RUnlock()
+
+	anomalies := make([]Anomaly, 0)
+	for mmsi, ship := range s.State {
+		if len(ship.Tags) == 0 {
+			continue
+		}
+		anomalies = append(anomalies, Anomaly{
+			MMSI:       mmsi,
+			Name:       ship.Name,
+			LatLon:     ship.LatLon,
+			SOG:        ship.SOG,
+			ShipType:   ship.ShipType,
+			Tags:       ship.Tags,
+			LastUpdate: ship.LastUpdate,
+		})
+	}
+
+	return anomalies
+}
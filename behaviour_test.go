@@ -0,0 +1,174 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestBehaviourAlerts(t *testing.T) {
+	now := time.Now().UTC().Unix()
+	offshore := []float64{52.6, 3.0}
+	rotterdam := []float64{51.95, 4.05}
+
+	tests := []struct {
+		name    string
+		latLon  []float64
+		state   State
+		history []History
+		want    []string
+	}{
+		{
+			name:  "speeding cargo",
+			state: State{ShipType: 70, SOG: 35, COG: 90, LastUpdate: now},
+			want:  []string{TAG_SPEED_ANOMALY},
+		},
+		{
+			name:  "cargo within limit",
+			state: State{ShipType: 70, SOG: 20, COG: 90, LastUpdate: now},
+			want:  []string{},
+		},
+		{
+			name:  "speed not available",
+			state: State{ShipType: 70, SOG: SOG_NOT_AVAILABLE, COG: 90, LastUpdate: now},
+			want:  []string{},
+		},
+		{
+			name:    "loitering",
+			state:   State{ShipType: 70, SOG: 0.2, LastUpdate: now},
+			history: []History{NewHistory(offshore, now), NewHistory(offshore, now-4*3600)},
+			want:    []string{TAG_LOITERING},
+		},
+		{
+			name:    "stopped briefly",
+			state:   State{ShipType: 70, SOG: 0.2, LastUpdate: now},
+			history: []History{NewHistory(offshore, now), NewHistory([]float64{52.9, 2.5}, now-3600)},
+			want:    []string{},
+		},
+		{
+			name:    "at anchor",
+			state:   State{ShipType: 70, SOG: 0.2, NavStatus: 1, LastUpdate: now},
+			history: []History{NewHistory(offshore, now), NewHistory(offshore, now-4*3600)},
+			want:    []string{},
+		},
+		{
+			name:    "moored",
+			state:   State{ShipType: 70, SOG: 0.2, NavStatus: 5, LastUpdate: now},
+			history: []History{NewHistory(offshore, now), NewHistory(offshore, now-4*3600)},
+			want:    []string{},
+		},
+		{
+			name:    "in port",
+			latLon:  rotterdam,
+			state:   State{ShipType: 70, SOG: 0.2, LastUpdate: now},
+			history: []History{NewHistory(rotterdam, now), NewHistory(rotterdam, now-4*3600)},
+			want:    []string{},
+		},
+		{
+			name:  "without history",
+			state: State{ShipType: 70, SOG: 0.2, LastUpdate: now},
+			want:  []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mmsi := 244000001
+			latLon := offshore
+			if tt.latLon != nil {
+				latLon = tt.latLon
+			}
+
+			s := newTestShips(map[int][]float64{mmsi: latLon})
+			ship := s.State[mmsi]
+			ship.ShipType = tt.state.ShipType
+			ship.SOG = tt.state.SOG
+			ship.COG = tt.state.COG
+			ship.NavStatus = tt.state.NavStatus
+			ship.LastUpdate = tt.state.LastUpdate
+			if tt.history != nil {
+				s.History[mmsi] = NewHistoryBufferFrom(tt.history)
+			}
+
+			events := NewEventBus()
+			c := events.Subscribe(EventFilter{Types: map[string]bool{EVENT_ALERT: true}})
+			b := NewBehaviour(*NewBehaviourDefaults())
+
+			// A second evaluation keeps the tags without raising the alerts again.
+			b.evaluate(s, events, NewVoyageDefaults().PortRadiusNm)
+			b.evaluate(s, events, NewVoyageDefaults().PortRadiusNm)
+
+			got := slices.Clone(ship.Tags)
+			if got == nil {
+				got = []string{}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Tags = %v, want %v", got, tt.want)
+			}
+
+			alerts := []string{}
+			for len(c) > 0 {
+				alerts = append(alerts, (<-c).Alert)
+			}
+			if !slices.Equal(alerts, tt.want) {
+				t.Errorf("alerts = %v, want %v", alerts, tt.want)
+			}
+		})
+	}
+}
+
+func TestCourseReversal(t *testing.T) {
+	now := time.Now().UTC().Unix()
+
+	tests := []struct {
+		name    string
+		samples []behaviourSample
+		want    bool
+	}{
+		{
+			name:    "reversal",
+			samples: []behaviourSample{{SOG: 10, COG: 10}, {SOG: 10, COG: 190}},
+			want:    true,
+		},
+		{
+			name:    "turn",
+			samples: []behaviourSample{{SOG: 10, COG: 10}, {SOG: 10, COG: 60}},
+			want:    false,
+		},
+		{
+			name:    "course not available",
+			samples: []behaviourSample{{SOG: 10, COG: 180}, {SOG: 10, COG: COG_NOT_AVAILABLE}},
+			want:    false,
+		},
+		{
+			name:    "course not available between samples",
+			samples: []behaviourSample{{SOG: 10, COG: 180}, {SOG: 10, COG: COG_NOT_AVAILABLE}, {SOG: 10, COG: 0}},
+			want:    false,
+		},
+		{
+			name:    "speed not available",
+			samples: []behaviourSample{{SOG: 10, COG: 10}, {SOG: SOG_NOT_AVAILABLE, COG: 190}},
+			want:    false,
+		},
+		{
+			name:    "too slow",
+			samples: []behaviourSample{{SOG: 1, COG: 10}, {SOG: 1, COG: 190}},
+			want:    false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBehaviour(*NewBehaviourDefaults())
+
+			var got bool
+			for i, sample := range tt.samples {
+				got = b.courseReversal(1, sample, now+int64(i)*60)
+			}
+
+			if got != tt.want {
+				t.Errorf("courseReversal() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
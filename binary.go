@@ -0,0 +1,132 @@
+package main
+
+import (
+	"cmp"
+	"encoding/binary"
+	"math"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	SHIPS_BINARY_MEDIA_TYPE = "application/vnd.seaspy.ships"
+	SHIPS_BINARY_VERSION    = 1
+	SHIPS_BINARY_FULL       = 1
+	SHIPS_BINARY_SCALE      = 1e5
+	SHIPS_BINARY_NO_GROUP   = 255
+)
+
+// EncodeShipsBinary encodes the fields the map draws for ships in a compact binary layout, well under a tenth the size of the JSON.
+//
+//	byte     format version, SHIPS_BINARY_VERSION
+//	byte     flags, SHIPS_BINARY_FULL when the ships replace the client's set
+//	uvarint  ships version, as in ShipsDelta
+//	uvarint  ship count, then per ship ordered by mmsi:
+//	  uvarint  mmsi, as the difference from the previous ship's
+//	  varint   lat and lon in 1e-5 degrees, as the difference from the previous ship's
+//	           the dead reckoned position when the ship has an estimate, matching the JSON estimate, otherwise the last reported
+//	  uvarint  rotation
+//	  byte     marker
+//	  byte     ship group, SHIPS_BINARY_NO_GROUP when the ship type is unknown
+//	uvarint  removed count, then the removed mmsis ordered and encoded as differences like ship mmsis
+//
+// Ships without a position are left out.
+func (s *Ships) EncodeShipsBinary(ships []EstimatedState, version uint64, full bool, removed []int) []byte {
+	type shipFields struct {
+		mmsi     int
+		lat      int64
+		lon      int64
+		rotation int
+		marker   int
+		group    int
+	}
+
+	fields := make([]shipFields, 0, len(ships))
+
+	s.StateLock.RLock()
+	for _, ship := range ships {
+		if len(ship.LatLon) != 2 {
+			continue
+		}
+
+		group := SHIPS_BINARY_NO_GROUP
+		if class, ok := ShipTypes[ship.ShipType]; ok {
+			group = class.GroupId
+		}
+
+		latLon := ship.LatLon
+		if ship.Estimate != nil {
+			latLon = ship.Estimate.LatLon
+		}
+
+		fields = append(fields, shipFields{
+			mmsi:     ship.MMSI,
+			lat:      int64(math.Round(latLon[0] * SHIPS_BINARY_SCALE)),
+			lon:      int64(math.Round(latLon[1] * SHIPS_BINARY_SCALE)),
+			rotation: ship.Rotation,
+			marker:   ship.Marker,
+			group:    group,
+		})
+	}
+	s.StateLock.RUnlock()
+
+	slices.SortFunc(fields, func(a, b shipFields) int {
+		return cmp.Compare(a.mmsi, b.mmsi)
+	})
+
+	var flags byte
+	if full {
+		flags |= SHIPS_BINARY_FULL
+	}
+
+	b := make([]byte, 0, 16+len(fields)*12+len(removed)*4)
+	b = append(b, SHIPS_BINARY_VERSION, flags)
+	b = binary.AppendUvarint(b, version)
+
+	b = binary.AppendUvarint(b, uint64(len(fields)))
+	var prev shipFields
+	for _, f := range fields {
+		b = binary.AppendUvarint(b, uint64(f.mmsi-prev.mmsi))
+		b = binary.AppendVarint(b, f.lat-prev.lat)
+		b = binary.AppendVarint(b, f.lon-prev.lon)
+		b = binary.AppendUvarint(b, uint64(max(f.rotation, 0)))
+		b = append(b, byte(f.marker), byte(f.group))
+		prev = f
+	}
+
+	removed = slices.Clone(removed)
+	slices.Sort(removed)
+	b = binary.AppendUvarint(b, uint64(len(removed)))
+	prevMMSI := 0
+	for _, mmsi := range removed {
+		b = binary.AppendUvarint(b, uint64(mmsi-prevMMSI))
+		prevMMSI = mmsi
+	}
+
+	return b
+}
+
+// acceptsShipsBinary reports whether the request's Accept header asks for SHIPS_BINARY_MEDIA_TYPE, JSON is sent otherwise.
+func acceptsShipsBinary(r *http.Request) bool {
+	for _, accept := range r.Header.Values("Accept") {
+		for _, part := range strings.Split(accept, ",") {
+			mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err != nil || mediaType != SHIPS_BINARY_MEDIA_TYPE {
+				continue
+			}
+
+			if q, ok := params["q"]; ok {
+				if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+					continue
+				}
+			}
+
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/binary"
+	"slices"
+	"testing"
+)
+
+// binaryShip is a decoded ship of the binary ships format.
+type binaryShip struct {
+	mmsi     int
+	latLon   [2]int64
+	rotation uint64
+	marker   byte
+	group    byte
+}
+
+func decodeShipsBinary(t *testing.T, b []byte) (bool, uint64, []binaryShip, []int) {
+	t.Helper()
+
+	if len(b) < 2 || b[0] != SHIPS_BINARY_VERSION {
+		t.Fatalf("unexpected binary header %v", b[:min(len(b), 2)])
+	}
+	full := b[1]&SHIPS_BINARY_FULL != 0
+	b = b[2:]
+
+	uvarint := func() uint64 {
+		v, n := binary.Uvarint(b)
+		if n <= 0 {
+			t.Fatalf("could not read uvarint")
+		}
+		b = b[n:]
+		return v
+	}
+	varint := func() int64 {
+		v, n := binary.Varint(b)
+		if n <= 0 {
+			t.Fatalf("could not read varint")
+		}
+		b = b[n:]
+		return v
+	}
+
+	version := uvarint()
+
+	ships := []binaryShip{}
+	var prev binaryShip
+	for range uvarint() {
+		ship := binaryShip{mmsi: prev.mmsi + int(uvarint())}
+		ship.latLon = [2]int64{prev.latLon[0] + varint(), prev.latLon[1] + varint()}
+		ship.rotation = uvarint()
+		ship.marker, ship.group = b[0], b[1]
+		b = b[2:]
+		ships = append(ships, ship)
+		prev = ship
+	}
+
+	removed := []int{}
+	mmsi := 0
+	for range uvarint() {
+		mmsi += int(uvarint())
+		removed = append(removed, mmsi)
+	}
+
+	if len(b) != 0 {
+		t.Errorf("%d trailing bytes", len(b))
+	}
+
+	return full, version, ships, removed
+}
+
+func TestEncodeShipsBinary(t *testing.T) {
+	s := NewShips()
+	rotterdam := &State{MMSI: 244000001, LatLon: []float64{51.9, 4.1}, ShipType: 70, Rotation: 90, Marker: 1}
+	sydney := &State{MMSI: 503000001, LatLon: []float64{-33.86785, 151.20732}, ShipType: 1000, Rotation: 270}
+	unplaced := &State{MMSI: 366000001, ShipType: 80}
+
+	tests := []struct {
+		name        string
+		ships       []EstimatedState
+		version     uint64
+		full        bool
+		removed     []int
+		wantShips   []binaryShip
+		wantRemoved []int
+	}{
+		{
+			name:      "full",
+			ships:     []EstimatedState{{State: sydney}, {State: rotterdam}, {State: unplaced}},
+			version:   1700000000000000,
+			full:      true,
+			wantShips: []binaryShip{{244000001, [2]int64{5190000, 410000}, 90, 1, 0}, {503000001, [2]int64{-3386785, 15120732}, 270, 0, SHIPS_BINARY_NO_GROUP}},
+		},
+		{
+			name:      "dead reckoned",
+			ships:     []EstimatedState{{State: rotterdam, Estimate: &Estimate{LatLon: []float64{51.95, 4.2}}}},
+			version:   2,
+			wantShips: []binaryShip{{244000001, [2]int64{5195000, 420000}, 90, 1, 0}},
+		},
+		{
+			name:        "removed",
+			ships:       []EstimatedState{},
+			version:     3,
+			removed:     []int{503000001, 244000001, 366000001},
+			wantShips:   []binaryShip{},
+			wantRemoved: []int{244000001, 366000001, 503000001},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			full, version, ships, removed := decodeShipsBinary(t, s.EncodeShipsBinary(tt.ships, tt.version, tt.full, tt.removed))
+
+			if full != tt.full || version != tt.version {
+				t.Errorf("full, version = %v, %d, want %v, %d", full, version, tt.full, tt.version)
+			}
+
+			if !slices.Equal(ships, tt.wantShips) {
+				t.Errorf("ships = %v, want %v", ships, tt.wantShips)
+			}
+
+			if tt.wantRemoved == nil {
+				tt.wantRemoved = []int{}
+			}
+			if !slices.Equal(removed, tt.wantRemoved) {
+				t.Errorf("removed = %v, want %v", removed, tt.wantRemoved)
+			}
+		})
+	}
+}
@@ -1,22 +1,23 @@
 package main
 
 import (
-	"fmt"
+	"math"
+	"sync"
 	"time"
 
 	"github.com/bbailey1024/geohash"
 )
 
 const (
-	LATMAX = 90.0
-	LATMIN = -90.0
-	LNGMAX = 180.0
-	LNGMIN = -180.0
+	LATMAX        = 90.0
+	LATMIN        = -90.0
+	LNGMAX        = 180.0
+	LNGMIN        = -180.0
+	GEOCACHE_BITS = 16
 )
 
 type Cache struct {
 	Timer  int
-	Geo    *Geocache
 	Search *Searchcache
 	Quit   chan struct{}
 	Done   chan struct{}
@@ -27,25 +28,23 @@ type Searchcache struct {
 }
 
 type SearchFields struct {
-	MMSI   int       `json:"mmsi"`
-	Name   string    `json:"name"`
-	LatLon []float64 `json:"latlon"`
+	MMSI        int       `json:"mmsi"`
+	Name        string    `json:"name"`
+	LatLon      []float64 `json:"latlon"`
+	Destination string    `json:"destination"`
 }
 
+// Geocache is a spatial index of ships bucketed by geohash at GEOCACHE_BITS precision.
+// It is updated as each position arrives, so bbox queries always reflect the latest ship positions.
 type Geocache struct {
-	List       []GeoMMSI
-	LastUpdate int64
-}
-
-type GeoMMSI struct {
-	MMSI    int
-	Geohash uint64
+	Lock    sync.RWMutex
+	Buckets map[uint64]map[int]struct{}
+	ships   map[int]uint64
 }
 
 func NewCache(t int) *Cache {
 	return &Cache{
 		Timer:  t,
-		Geo:    NewGeocache(),
 		Search: NewSearchcache(),
 		Quit:   make(chan struct{}),
 		Done:   make(chan struct{}),
@@ -60,8 +59,8 @@ func NewSearchcache() *Searchcache {
 
 func NewGeocache() *Geocache {
 	return &Geocache{
-		List:       []GeoMMSI{},
-		LastUpdate: 0,
+		Buckets: map[uint64]map[int]struct{}{},
+		ships:   map[int]uint64{},
 	}
 }
 
@@ -69,7 +68,6 @@ func (c *Cache) Run(s *Ships) {
 
 	// Generate every second for the first five seconds.
 	for i := 0; i < 5; i++ {
-		c.Geo.Generate(s)
 		c.Search.Generate(s)
 		time.Sleep(time.Second * 1)
 	}
@@ -79,7 +77,6 @@ func (c *Cache) Run(s *Ships) {
 	for {
 		select {
 		case <-ticker.C:
-			c.Geo.Generate(s)
 			c.Search.Generate(s)
 		case <-c.Quit:
 			c.Done <- struct{}{}
@@ -92,125 +89,132 @@ func (sc *Searchcache) Generate(s *Ships) {
 	s.StateLock.RLock()
 	defer s.StateLock.RUnlock()
 
+	s.InfoLock.RLock()
+	defer s.InfoLock.RUnlock()
+
 	searchList := make([]SearchFields, 0, len(s.State))
 
 	for mmsi, ship := range s.State {
+		var destination string
+		if info, ok := s.Info[mmsi]; ok {
+			destination = info.DestinationLocode
+		}
+
 		searchList = append(searchList, SearchFields{
-			MMSI:   mmsi,
-			Name:   ship.Name,
-			LatLon: ship.LatLon,
+			MMSI:        mmsi,
+			Name:        ship.Name,
+			LatLon:      ship.LatLon,
+			Destination: destination,
 		})
 	}
 
 	sc.List = searchList
 }
 
-func (gc *Geocache) Generate(s *Ships) {
-	s.StateLock.RLock()
-	defer s.StateLock.RUnlock()
-
-	geoSortedMMSI := make([]GeoMMSI, 0, len(s.State))
-	for mmsi, state := range s.State {
-		geoSortedMMSI = append(geoSortedMMSI, GeoMMSI{MMSI: mmsi, Geohash: state.Geohash})
-	}
+// Update moves mmsi to the bucket containing latLon.
+func (gc *Geocache) Update(mmsi int, latLon []float64) {
+	bucket := geohash.EncodeIntPrecision(latLon[0], latLon[1], GEOCACHE_BITS)
 
-	gc.LastUpdate = time.Now().Unix()
+	gc.Lock.Lock()
+	defer gc.Lock.Unlock()
 
-	quickSortGeohash(geoSortedMMSI, 0, len(geoSortedMMSI))
+	if current, ok := gc.ships[mmsi]; ok {
+		if current == bucket {
+			return
+		}
+		gc.remove(mmsi, current)
+	}
 
-	gc.List = geoSortedMMSI
+	if _, ok := gc.Buckets[bucket]; !ok {
+		gc.Buckets[bucket] = map[int]struct{}{}
+	}
+	gc.Buckets[bucket][mmsi] = struct{}{}
+	gc.ships[mmsi] = bucket
 }
 
-func (gc *Geocache) BinarySearch(bbox [2][2]float64) (int, int, error) {
+func (gc *Geocache) Remove(mmsi int) {
+	gc.Lock.Lock()
+	defer gc.Lock.Unlock()
 
-	if len(gc.List) == 0 {
-		return 0, 0, fmt.Errorf("geocache list is empty, binary search cannot be performed")
+	if current, ok := gc.ships[mmsi]; ok {
+		gc.remove(mmsi, current)
 	}
-
-	bboxHashSW := geohash.EncodeInt(bbox[0][0], bbox[0][1])
-	bboxHashNE := geohash.EncodeInt(bbox[1][0], bbox[1][1])
-
-	begin := gc.binarySearchSW(bboxHashSW)
-	end := gc.binarySearchNE(bboxHashNE)
-
-	return begin, end, nil
 }
 
-func (gc *Geocache) binarySearchSW(bboxSW uint64) int {
-	mid := len(gc.List) / 2
-	top := len(gc.List)
-
-	begin := 0
+func (gc *Geocache) remove(mmsi int, bucket uint64) {
+	delete(gc.Buckets[bucket], mmsi)
+	if len(gc.Buckets[bucket]) == 0 {
+		delete(gc.Buckets, bucket)
+	}
+	delete(gc.ships, mmsi)
+}
 
-	for {
-		if gc.List[mid].Geohash >= bboxSW {
-			if mid-1 < 0 || gc.List[mid-1].Geohash < bboxSW {
-				begin = mid
-				break
-			}
+// Search returns the mmsis in every bucket overlapping bbox.
+// Buckets are coarse, so callers filter the ships to the exact bbox.
+func (gc *Geocache) Search(bbox [2][2]float64) []int {
+	rows, cols, latStep, lonStep := geocacheGrid()
 
-			top = mid
-			mid = mid / 2
+	gc.Lock.RLock()
+	defer gc.Lock.RUnlock()
 
-		} else {
-			if mid+1 >= len(gc.List) || gc.List[mid+1].Geohash > bboxSW {
-				begin = mid + 1 // Does this break things? Should it just be mid?
-				break
+	mmsis := []int{}
+	for row := gridIndex(bbox[0][0], LATMIN, latStep, rows); row <= gridIndex(bbox[1][0], LATMIN, latStep, rows); row++ {
+		for col := gridIndex(bbox[0][1], LNGMIN, lonStep, cols); col <= gridIndex(bbox[1][1], LNGMIN, lonStep, cols); col++ {
+			for mmsi := range gc.Buckets[gridBucket(row, col)] {
+				mmsis = append(mmsis, mmsi)
 			}
-			mid = mid + ((top - mid) / 2)
 		}
 	}
 
-	return begin
+	return mmsis
 }
 
-func (gc *Geocache) binarySearchNE(bboxNE uint64) int {
-	mid := len(gc.List) / 2
-	top := len(gc.List)
-
-	end := 0
-
-	for {
-		if gc.List[mid].Geohash < bboxNE {
-			if mid+1 >= len(gc.List) || gc.List[mid+1].Geohash > bboxNE {
-				end = mid
-				break
+// Ring returns the mmsis in the buckets exactly radius buckets away from the bucket containing latLon, measured as the larger of the row and column distance.
+// Columns wrap the antimeridian while rows stop at the poles.
+func (gc *Geocache) Ring(latLon []float64, radius int) []int {
+	rows, cols, latStep, lonStep := geocacheGrid()
+	centreRow := gridIndex(latLon[0], LATMIN, latStep, rows)
+	centreCol := gridIndex(latLon[1], LNGMIN, lonStep, cols)
+
+	gc.Lock.RLock()
+	defer gc.Lock.RUnlock()
+
+	mmsis := []int{}
+	for row := max(centreRow-radius, 0); row <= min(centreRow+radius, rows-1); row++ {
+		edge := row == centreRow-radius || row == centreRow+radius
+		for col := 0; col < cols; col++ {
+			d := (col - centreCol + cols) % cols
+			d = min(d, cols-d)
+			if d > radius || (!edge && d != radius) {
+				continue
 			}
-			mid = mid + ((top - mid) / 2)
 
-		} else {
-			if mid-1 < 0 || gc.List[mid-1].Geohash < bboxNE {
-				end = mid - 1
-				break
+			for mmsi := range gc.Buckets[gridBucket(row, col)] {
+				mmsis = append(mmsis, mmsi)
 			}
-
-			top = mid
-			mid = mid / 2
 		}
 	}
 
-	return end
+	return mmsis
 }
 
-func quickSortGeohash(list []GeoMMSI, begin int, end int) {
-
-	// End sorting partition branch when finished.
-	if begin-end == 0 {
-		return
-	}
-
-	pivot := end - 1
-	swap := begin
-
-	for i := begin; i < pivot; i++ {
-		if list[i].Geohash < list[pivot].Geohash {
-			list[i], list[swap] = list[swap], list[i]
-			swap++
-		}
-	}
+// geocacheGrid returns the number of rows and columns of geocache buckets and their size in degrees.
+func geocacheGrid() (int, int, float64, float64) {
+	latBits := GEOCACHE_BITS / 2
+	lonBits := GEOCACHE_BITS - latBits
+	rows := int(math.Exp2(float64(latBits)))
+	cols := int(math.Exp2(float64(lonBits)))
+	return rows, cols, (LATMAX - LATMIN) / float64(rows), (LNGMAX - LNGMIN) / float64(cols)
+}
 
-	list[pivot], list[swap] = list[swap], list[pivot]
+func gridIndex(v float64, vmin float64, step float64, n int) int {
+	return min(max(int(math.Floor((v-vmin)/step)), 0), n-1)
+}
 
-	quickSortGeohash(list, begin, swap)
-	quickSortGeohash(list, swap+1, end)
+// gridBucket encodes the centre of a bucket, which avoids ambiguity on bucket edges.
+func gridBucket(row int, col int) uint64 {
+	_, _, latStep, lonStep := geocacheGrid()
+	lat := LATMIN + (float64(row)+0.5)*latStep
+	lon := LNGMIN + (float64(col)+0.5)*lonStep
+	return geohash.EncodeIntPrecision(lat, lon, GEOCACHE_BITS)
 }
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"time"
+)
+
+// DeadReckoning configures server side position extrapolation for ships that report infrequently.
+// Positions are only extrapolated when the last report is older than MinSeconds and no older than MaxMinutes.
+// The uncertainty radius grows from UncertaintyNm by UncertaintyPct of the distance travelled since the last report.
+type DeadReckoning struct {
+	Enable         bool    `json:"enable"`
+	MinSeconds     int     `json:"minSeconds"`
+	MaxMinutes     int     `json:"maxMinutes"`
+	UncertaintyNm  float64 `json:"uncertaintyNm"`
+	UncertaintyPct float64 `json:"uncertaintyPct"`
+}
+
+// Estimate is a dead reckoned position along with the radius in nautical miles the ship is expected to be within.
+type Estimate struct {
+	LatLon        []float64 `json:"latlon"`
+	UncertaintyNm float64   `json:"uncertaintyNm"`
+	Timestamp     int64     `json:"timestamp"`
+}
+
+// EstimatedState is returned by bounding box queries and carries the reported state alongside an optional estimate.
+type EstimatedState struct {
+	*State
+	Estimate *Estimate `json:"estimate,omitempty"`
+}
+
+func NewDeadReckoningDefaults() DeadReckoning {
+	return DeadReckoning{
+		Enable:         true,
+		MinSeconds:     60,
+		MaxMinutes:     30,
+		UncertaintyNm:  0.1,
+		UncertaintyPct: 10,
+	}
+}
+
+// DeadReckon attaches an estimated current position to each ship that qualifies for extrapolation.
+func (s *Ships) DeadReckon(ships []*State, dr DeadReckoning) []EstimatedState {
+	now := time.Now().Unix()
+
+	estimated := make([]EstimatedState, 0, len(ships))
+
+	s.StateLock.RLock()
+	for _, ship := range ships {
+		es := EstimatedState{State: ship}
+		if dr.Enable {
+			es.Estimate = dr.estimate(*ship, now)
+		}
+		estimated = append(estimated, es)
+	}
+	s.StateLock.RUnlock()
+
+	return estimated
+}
+
+// estimate extrapolates the ship's last reported position along its course over ground at its speed over ground.
+// Returns nil for ships that are stationary, anchored, moored, without an available speed or course, or whose report falls outside the extrapolation window.
+func (dr DeadReckoning) estimate(ship State, now int64) *Estimate {
+	if len(ship.LatLon) != 2 {
+		return nil
+	}
+
+	if ship.NavStatus == 1 || ship.NavStatus == 5 || ship.NavStatus == 6 {
+		return nil
+	}
+
+	if ship.SOG <= MOVING_SPEED_THRESHOLD || ship.SOG >= SOG_NOT_AVAILABLE {
+		return nil
+	}
+
+	if ship.COG >= COG_NOT_AVAILABLE {
+		return nil
+	}
+
+	elapsed := now - ship.LastUpdate
+	if elapsed < int64(dr.MinSeconds) || elapsed > int64(dr.MaxMinutes*60) {
+		return nil
+	}
+
+	dist := ship.SOG * float64(elapsed) / 3600
+
+	return &Estimate{
+		LatLon:        destination(ship.LatLon, ship.COG, dist),
+		UncertaintyNm: dr.UncertaintyNm + dist*dr.UncertaintyPct/100,
+		Timestamp:     now,
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDeadReckoningEstimate(t *testing.T) {
+	const now = 1700000000
+	dr := NewDeadReckoningDefaults()
+
+	// Ten knots for six minutes covers one nautical mile, close to a minute of latitude when heading north.
+	moving := State{LatLon: []float64{50, 0}, SOG: 10, COG: 0, LastUpdate: now - 360}
+
+	tests := []struct {
+		name   string
+		modify func(ship *State)
+		want   []float64
+	}{
+		{name: "north", want: []float64{50 + 1.0/60, 0}},
+		{name: "east across the antimeridian", modify: func(ship *State) { ship.LatLon = []float64{0, 179.99}; ship.COG = 90 }, want: []float64{0, 179.99 + 1.0/60 - 360}},
+		{name: "moored", modify: func(ship *State) { ship.NavStatus = 5 }},
+		{name: "at anchor", modify: func(ship *State) { ship.NavStatus = 1 }},
+		{name: "stationary", modify: func(ship *State) { ship.SOG = 0.1 }},
+		{name: "speed not available", modify: func(ship *State) { ship.SOG = SOG_NOT_AVAILABLE }},
+		{name: "course not available", modify: func(ship *State) { ship.COG = COG_NOT_AVAILABLE }},
+		{name: "recent report", modify: func(ship *State) { ship.LastUpdate = now - 10 }},
+		{name: "stale report", modify: func(ship *State) { ship.LastUpdate = now - 3600 }},
+		{name: "no position", modify: func(ship *State) { ship.LatLon = nil }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ship := moving
+			if tt.modify != nil {
+				tt.modify(&ship)
+			}
+
+			got := dr.estimate(ship, now)
+			if tt.want == nil {
+				if got != nil {
+					t.Errorf("estimate() = %v, want nil", got.LatLon)
+				}
+				return
+			}
+
+			if got == nil {
+				t.Fatalf("estimate() = nil, want %v", tt.want)
+			}
+
+			if math.Abs(got.LatLon[0]-tt.want[0]) > 1e-4 || math.Abs(got.LatLon[1]-tt.want[1]) > 1e-4 {
+				t.Errorf("estimate() = %v, want %v", got.LatLon, tt.want)
+			}
+
+			if want := dr.UncertaintyNm + 1*dr.UncertaintyPct/100; math.Abs(got.UncertaintyNm-want) > 1e-6 {
+				t.Errorf("estimate() uncertainty = %v, want %v", got.UncertaintyNm, want)
+			}
+		})
+	}
+}
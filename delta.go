@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+const (
+	DELTA_TOMBSTONE_LIMIT = 100000
+	DELTA_TOMBSTONE_TRIM  = DELTA_TOMBSTONE_LIMIT * 9 / 10
+)
+
+// Tombstone records a ship removed from state at sequence Seq, so delta responses can tell clients to drop it.
+type Tombstone struct {
+	MMSI int
+	Seq  uint64
+}
+
+// ShipsDelta is the change to the ships inside a bbox since a client's last version.
+// Full is true when the server could not compute a delta, such as after a restart or when the tombstones needed have been dropped,
+// in which case Ships holds every ship in the bbox and the client should replace its set.
+type ShipsDelta struct {
+	Version uint64           `json:"version"`
+	Full    bool             `json:"full"`
+	Ships   []EstimatedState `json:"ships"`
+	Removed []int            `json:"removed"`
+}
+
+// newShipsVersion seeds the update sequence from the clock, so versions keep increasing across restarts
+// and a version handed out before a restart is never mistaken for a newer one.
+func newShipsVersion() uint64 {
+	return uint64(time.Now().UnixMicro())
+}
+
+// Touch advances the update sequence and stamps it on mmsi, marking the ship as changed for delta responses.
+func (s *Ships) Touch(mmsi int) {
+	s.StateLock.Lock()
+	defer s.StateLock.Unlock()
+
+	if ship, ok := s.State[mmsi]; ok {
+		s.touch(ship)
+	}
+}
+
+func (s *Ships) CurrentVersion() uint64 {
+	s.StateLock.RLock()
+	defer s.StateLock.RUnlock()
+
+	return s.Version
+}
+
+// touch stamps the next sequence on ship, the caller must hold StateLock.
+func (s *Ships) touch(ship *State) {
+	s.Version++
+	ship.Seq = s.Version
+}
+
+// tombstone records the removal of mmsi, the caller must hold StateLock.
+// Beyond DELTA_TOMBSTONE_LIMIT the oldest tombstones are dropped down to DELTA_TOMBSTONE_TRIM, so the trim runs once per batch of removals
+// rather than on each one. Clients older than the dropped tombstones get a full response.
+func (s *Ships) tombstone(mmsi int) {
+	s.Version++
+	s.Tombstones = append(s.Tombstones, Tombstone{MMSI: mmsi, Seq: s.Version})
+
+	if len(s.Tombstones) > DELTA_TOMBSTONE_LIMIT {
+		drop := len(s.Tombstones) - DELTA_TOMBSTONE_TRIM
+		s.tombstoneFloor = s.Tombstones[drop-1].Seq
+		s.Tombstones = slices.Delete(s.Tombstones, 0, drop)
+	}
+}
+
+// GetShipsInBoxSince returns the ships inside bbox updated after version since, and a delta holding the current version and the mmsis removed since.
+// Ships that moved out of bbox are not reported as removed, clients drop ships outside their viewport themselves and request a full set when the viewport changes.
+func (s *Ships) GetShipsInBoxSince(bbox [2][2]float64, since uint64) ([]*State, ShipsDelta, error) {
+	delta := ShipsDelta{Removed: []int{}}
+
+	if !validBbox(bbox) {
+		return nil, delta, fmt.Errorf("bounding box out of range")
+	}
+
+	candidates := []int{}
+	for _, b := range splitBbox(bbox) {
+		candidates = append(candidates, s.Geo.Search(b)...)
+	}
+
+	ships := make([]*State, 0)
+
+	s.StateLock.RLock()
+	defer s.StateLock.RUnlock()
+
+	delta.Version = s.Version
+	delta.Full = since > s.Version || since < s.tombstoneFloor
+
+	for _, mmsi := range candidates {
+		ship, ok := s.State[mmsi]
+		if ok && (delta.Full || ship.Seq > since) && inBbox(ship.LatLon, bbox) {
+			ships = append(ships, ship)
+		}
+	}
+
+	if !delta.Full {
+		for i := len(s.Tombstones) - 1; i >= 0 && s.Tombstones[i].Seq > since; i-- {
+			delta.Removed = append(delta.Removed, s.Tombstones[i].MMSI)
+		}
+	}
+
+	return ships, delta, nil
+}
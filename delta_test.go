@@ -0,0 +1,118 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestGetShipsInBoxSince(t *testing.T) {
+	s := newTestShips(map[int][]float64{
+		1: {51.9, 4.1},
+		2: {52.0, 4.2},
+		3: {52.1, 4.3},
+	})
+	bbox := [2][2]float64{{50, 3}, {53, 5}}
+	base := s.CurrentVersion()
+
+	// Ship 1 is updated, ship 2 removed by swabby, then ship 3 updated.
+	s.Touch(1)
+	s.StateLock.Lock()
+	delete(s.State, 2)
+	s.Geo.Remove(2)
+	s.tombstone(2)
+	s.StateLock.Unlock()
+	s.Touch(3)
+
+	tests := []struct {
+		name        string
+		since       uint64
+		wantFull    bool
+		wantShips   []int
+		wantRemoved []int
+	}{
+		{name: "before restart", since: base - 1, wantFull: true, wantShips: []int{1, 3}, wantRemoved: []int{}},
+		{name: "before updates", since: base, wantShips: []int{1, 3}, wantRemoved: []int{2}},
+		{name: "after first update", since: base + 1, wantShips: []int{3}, wantRemoved: []int{2}},
+		{name: "after removal", since: base + 2, wantShips: []int{3}, wantRemoved: []int{}},
+		{name: "current", since: base + 3, wantShips: []int{}, wantRemoved: []int{}},
+		{name: "from the future", since: base + 10, wantFull: true, wantShips: []int{1, 3}, wantRemoved: []int{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ships, delta, err := s.GetShipsInBoxSince(bbox, tt.since)
+			if err != nil {
+				t.Fatalf("GetShipsInBoxSince failed: %s", err.Error())
+			}
+
+			mmsis := []int{}
+			for _, ship := range ships {
+				mmsis = append(mmsis, ship.MMSI)
+			}
+			slices.Sort(mmsis)
+
+			if delta.Version != base+3 || delta.Full != tt.wantFull {
+				t.Errorf("version, full = %d, %v, want %d, %v", delta.Version, delta.Full, base+3, tt.wantFull)
+			}
+
+			if !slices.Equal(mmsis, tt.wantShips) {
+				t.Errorf("ships = %v, want %v", mmsis, tt.wantShips)
+			}
+
+			if !slices.Equal(delta.Removed, tt.wantRemoved) {
+				t.Errorf("removed = %v, want %v", delta.Removed, tt.wantRemoved)
+			}
+		})
+	}
+}
+
+func TestTombstoneLimit(t *testing.T) {
+	s := NewShips()
+	base := s.CurrentVersion()
+
+	s.StateLock.Lock()
+	for mmsi := range DELTA_TOMBSTONE_LIMIT {
+		s.tombstone(mmsi)
+	}
+	s.StateLock.Unlock()
+
+	if len(s.Tombstones) != DELTA_TOMBSTONE_LIMIT {
+		t.Errorf("len(Tombstones) = %d, want %d", len(s.Tombstones), DELTA_TOMBSTONE_LIMIT)
+	}
+
+	// Exceeding the limit trims down to DELTA_TOMBSTONE_TRIM, the next removal is appended without trimming.
+	s.StateLock.Lock()
+	s.tombstone(DELTA_TOMBSTONE_LIMIT)
+	s.tombstone(DELTA_TOMBSTONE_LIMIT + 1)
+	s.StateLock.Unlock()
+
+	if len(s.Tombstones) != DELTA_TOMBSTONE_TRIM+1 {
+		t.Errorf("len(Tombstones) = %d, want %d", len(s.Tombstones), DELTA_TOMBSTONE_TRIM+1)
+	}
+
+	dropped := uint64(DELTA_TOMBSTONE_LIMIT + 1 - DELTA_TOMBSTONE_TRIM)
+
+	tests := []struct {
+		name        string
+		since       uint64
+		wantFull    bool
+		wantRemoved int
+	}{
+		{name: "dropped tombstones", since: base + dropped - 1, wantFull: true},
+		{name: "oldest kept tombstone", since: base + dropped, wantRemoved: DELTA_TOMBSTONE_TRIM + 1},
+		{name: "latest tombstone", since: base + DELTA_TOMBSTONE_LIMIT + 1, wantRemoved: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, delta, err := s.GetShipsInBoxSince([2][2]float64{{LATMIN, LNGMIN}, {LATMAX, LNGMAX}}, tt.since)
+			if err != nil {
+				t.Fatalf("GetShipsInBoxSince failed: %s", err.Error())
+			}
+
+			if delta.Full != tt.wantFull || len(delta.Removed) != tt.wantRemoved {
+				t.Errorf("GetShipsInBoxSince(%d) = full %v with %d removed, want full %v with %d removed", tt.since, delta.Full, len(delta.Removed), tt.wantFull, tt.wantRemoved)
+			}
+		})
+	}
+}
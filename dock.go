@@ -20,14 +20,31 @@ const (
 )
 
 type Dock struct {
-	ShipHistory bool `json:"shipHistory"`
-	CacheTimer  int  `json:"cacheTimer"`
-	Workers     int  `json:"workerCount"`
-	WorkerList  []*DockWorker
-	Quit        chan struct{}
-	Done        chan struct{}
-	Ships       *Ships
-	Cache       *Cache
+	ShipHistory   bool          `json:"shipHistory"`
+	CacheTimer    int           `json:"cacheTimer"`
+	Workers       int           `json:"workerCount"`
+	Encounter     Encounter     `json:"encounter"`
+	DeadReckoning DeadReckoning `json:"deadReckoning"`
+	Voyage        Voyage        `json:"voyage"`
+	Eta           Eta           `json:"eta"`
+	Route         Route         `json:"route"`
+	Snapshot      Snapshot      `json:"snapshot"`
+	Wal           Wal           `json:"wal"`
+	Tracks        Tracks        `json:"trackStore"`
+	HistoryLimits HistoryLimits `json:"historyLimits"`
+	Geofences     []Geofence    `json:"geofences"`
+	WorkerList    []*DockWorker
+	Quit          chan struct{}
+	Done          chan struct{}
+	Ships         *Ships
+	Cache         *Cache
+	Lanes         *Lanes
+	Snapshotter   *Snapshotter
+	WriteAheadLog *WriteAheadLog
+	TrackStore    *TrackStore
+	Playbacks     *Playbacks
+	Live          *LiveFeed
+	Events        *EventBus
 }
 
 type Ships struct {
@@ -36,7 +53,13 @@ type Ships struct {
 	InfoLock    sync.RWMutex
 	Info        map[int]*Info
 	HistoryLock sync.RWMutex
-	History     map[int][]History
+	History     map[int]*HistoryBuffer
+	Geo         *Geocache
+
+	// Version is the latest update sequence, stamped on ships as Seq when they change. Guarded by StateLock.
+	Version        uint64
+	Tombstones     []Tombstone
+	tombstoneFloor uint64
 }
 
 type State struct {
@@ -46,16 +69,26 @@ type State struct {
 	Geohash    uint64    `json:"geohash"`
 	Heading    int       `json:"heading"`
 	SOG        float64   `json:"sog"`
+	COG        float64   `json:"cog"`
 	NavStatus  int       `json:"navStatus"`
 	ShipType   int       `json:"shipType"`
 	Marker     int       `json:"marker"`
 	Rotation   int       `json:"rotation"`
 	LastUpdate int64     `json:"lastUpdate"`
+	Tags       []string  `json:"tags,omitempty"`
+	Seq        uint64    `json:"seq"`
+
+	// navStatusSeen is set by a ship's first position report, NavStatus holds the default of 0 until then.
+	// It is not kept in snapshots, so the first report after a restart is not treated as a change.
+	navStatusSeen bool
 }
 
 type Info struct {
-	Destination string `json:"destination"`
-	IMONumber   int    `json:"imoNumber"`
+	Destination           string  `json:"destination"`
+	DestinationLocode     string  `json:"destinationLocode"`
+	DestinationConfidence float64 `json:"destinationConfidence"`
+	ReportedEta           int64   `json:"reportedEta"`
+	IMONumber             int     `json:"imoNumber"`
 }
 
 type History struct {
@@ -64,16 +97,20 @@ type History struct {
 }
 
 type InfoWindow struct {
-	Name        string    `json:"name"`
-	MMSI        int       `json:"mmsi"`
-	LatLon      []float64 `json:"latlon"`
-	Heading     int       `json:"heading"`
-	SOG         float64   `json:"sog"`
-	NavStatus   int       `json:"navStatus"`
-	ShipType    int       `json:"shipType"`
-	LastUpdate  int64     `json:"lastUpdate"`
-	Destination string    `json:"destination"`
-	IMONumber   int       `json:"imoNumber"`
+	Name              string          `json:"name"`
+	MMSI              int             `json:"mmsi"`
+	LatLon            []float64       `json:"latlon"`
+	Heading           int             `json:"heading"`
+	SOG               float64         `json:"sog"`
+	NavStatus         int             `json:"navStatus"`
+	ShipType          int             `json:"shipType"`
+	LastUpdate        int64           `json:"lastUpdate"`
+	Destination       string          `json:"destination"`
+	DestinationLocode string          `json:"destinationLocode"`
+	IMONumber         int             `json:"imoNumber"`
+	Tags              []string        `json:"tags"`
+	Encounters        []EncounterRisk `json:"encounters"`
+	Eta               EtaPrediction   `json:"eta"`
 }
 
 type ShipDump struct {
@@ -92,25 +129,97 @@ func NewDock(d Dock) *Dock {
 	d.Quit = make(chan struct{})
 	d.Done = make(chan struct{})
 	d.Ships = NewShips()
+	d.WriteAheadLog = NewWriteAheadLog(d.Wal)
+	d.TrackStore = NewTrackStore(d.Tracks)
+	d.Playbacks = NewPlaybacks()
+	d.Live = NewLiveFeed()
+	d.Events = NewEventBus()
+
+	for i := range d.Geofences {
+		d.Geofences[i].bbox = polygonBbox(d.Geofences[i].Polygon)
+	}
+
+	// Configs written before history limits existed would otherwise keep a single point per ship.
+	if d.HistoryLimits.Default.Recent < 1 {
+		d.HistoryLimits.Default = NewHistoryLimitsDefaults().Default
+	}
+
+	// Wal segments are only compacted once a snapshot covers them, without snapshots they would grow without bound.
+	if d.Wal.Enable && !d.Snapshot.Enable {
+		log.Fatalf("dock wal requires dock snapshots to be enabled, set snapshot.enable to true or wal.enable to false\n")
+	}
+
+	// Open the track store before replaying the wal so replayed positions are stored.
+	err := d.TrackStore.Open()
+	if err != nil {
+		log.Fatalf("could not open track store: %s\n", err.Error())
+	}
+
+	var walSegment uint64
+	if d.Snapshot.Enable {
+		ships, segment, err := LoadSnapshot(d.Snapshot.Dir)
+		if err != nil {
+			fmt.Printf("could not restore snapshot: %s\n", err.Error())
+		} else {
+			d.Ships = ships
+			walSegment = segment
+		}
+	}
+
+	if d.Wal.Enable {
+		n, err := ReplayWal(d.Wal.Dir, walSegment, func(r WalRecord) {
+			d.Process(r.Payload, r.Timestamp)
+		})
+		if err != nil {
+			fmt.Printf("could not replay wal: %s\n", err.Error())
+		} else {
+			fmt.Printf("replayed %d wal records\n", n)
+		}
+
+		err = d.WriteAheadLog.Open()
+		if err != nil {
+			log.Fatalf("could not open wal: %s\n", err.Error())
+		}
+	}
+
 	return &d
 }
 
 func NewDockDefaults() *Dock {
 	return &Dock{
-		Workers:     10,
-		WorkerList:  []*DockWorker{},
-		Quit:        make(chan struct{}),
-		Done:        make(chan struct{}),
-		Ships:       NewShips(),
-		ShipHistory: true,
+		Workers:       10,
+		WorkerList:    []*DockWorker{},
+		Quit:          make(chan struct{}),
+		Done:          make(chan struct{}),
+		Ships:         NewShips(),
+		ShipHistory:   true,
+		Encounter:     NewEncounterDefaults(),
+		DeadReckoning: NewDeadReckoningDefaults(),
+		Voyage:        NewVoyageDefaults(),
+		Eta:           NewEtaDefaults(),
+		Route:         NewRouteDefaults(),
+		Snapshot:      NewSnapshotDefaults(),
+		Wal:           NewWalDefaults(),
+		Tracks:        NewTracksDefaults(),
+		HistoryLimits: NewHistoryLimitsDefaults(),
+		WriteAheadLog: NewWriteAheadLog(NewWalDefaults()),
+		TrackStore:    NewTrackStore(NewTracksDefaults()),
+		Playbacks:     NewPlaybacks(),
+		Live:          NewLiveFeed(),
+		Events:        NewEventBus(),
 	}
 }
 
 func NewShips() *Ships {
+	version := newShipsVersion()
 	return &Ships{
 		State:   map[int]*State{},
 		Info:    map[int]*Info{},
-		History: map[int][]History{},
+		History: map[int]*HistoryBuffer{},
+		Geo:     NewGeocache(),
+		Version: version,
+		// Tombstones are not persisted, so versions from before a restart always get a full response.
+		tombstoneFloor: version,
 	}
 }
 
@@ -129,16 +238,38 @@ func (d *Dock) Run(msg <-chan []byte) {
 	d.Cache = NewCache(d.CacheTimer)
 	go d.Cache.Run(d.Ships)
 
+	d.Lanes = NewLanes(d.Route)
+	go d.Lanes.Run(d.Ships)
+
+	go d.WriteAheadLog.Run()
+	go d.TrackStore.Run()
+
+	d.Snapshotter = NewSnapshotter(d.Snapshot)
+	go d.Snapshotter.Run(d.Ships, d.WriteAheadLog)
+
 	<-d.Quit
 
 	d.Cache.Quit <- struct{}{}
 	<-d.Cache.Done
 
+	d.Lanes.Quit <- struct{}{}
+	<-d.Lanes.Done
+
 	for _, dw := range d.WorkerList {
 		dw.Quit <- struct{}{}
 		<-dw.Done
 	}
 
+	// Stop the snapshotter last so its final snapshot includes every processed message.
+	d.Snapshotter.Quit <- struct{}{}
+	<-d.Snapshotter.Done
+
+	d.WriteAheadLog.Quit <- struct{}{}
+	<-d.WriteAheadLog.Done
+
+	d.TrackStore.Quit <- struct{}{}
+	<-d.TrackStore.Done
+
 	d.Done <- struct{}{}
 }
 
@@ -156,36 +287,92 @@ func (dw *DockWorker) Work(d *Dock, msg <-chan []byte) {
 			dw.Done <- struct{}{}
 			return
 		case b := <-msg:
-			var p aisstream.Packet
-			err := json.Unmarshal(b, &p)
-			if err != nil {
-				fmt.Printf("dock worker failed to unmarshal packet: %s\n", err.Error())
+			timestamp := time.Now().Unix()
+			if !d.Process(b, timestamp) {
 				continue
 			}
 
-			if p.Metadata.MMSI == 0 {
-				continue
+			err := d.WriteAheadLog.Append(timestamp, b)
+			if err != nil {
+				fmt.Printf("dock worker failed to append to wal: %s\n", err.Error())
 			}
+		}
+	}
+}
 
-			d.Ships.StateLock.Lock()
-			d.Ships.NewShip(p.Metadata.MMSI)
-			d.Ships.UpdateMetadata(p.Metadata)
-			d.Ships.StateLock.Unlock()
+// Process applies a raw aisstream packet received at timestamp to the ships.
+// Returns false if the packet was rejected, including packets older than the ship's last update, which occur when replaying the wal over a snapshot.
+func (d *Dock) Process(b []byte, timestamp int64) bool {
+	var p aisstream.Packet
+	err := json.Unmarshal(b, &p)
+	if err != nil {
+		fmt.Printf("dock worker failed to unmarshal packet: %s\n", err.Error())
+		return false
+	}
 
-			if d.ShipHistory {
-				d.Ships.UpdateHistory(p.Metadata.MMSI, []float64{p.Metadata.Latitude, p.Metadata.Longitude})
-			}
+	if p.Metadata.MMSI == 0 {
+		return false
+	}
 
-			switch p.MsgType {
-			case "PositionReport":
-				d.Ships.UpdatePositionReport(p.Metadata.MMSI, p.Msg.PositionReport)
-			case "ShipStaticData":
-				d.Ships.UpdateShipStaticData(p.Metadata.MMSI, p.Msg.ShipStaticData)
+	d.Ships.StateLock.Lock()
+	prev, existed := d.Ships.State[p.Metadata.MMSI]
+	if existed && prev.LastUpdate > timestamp {
+		d.Ships.StateLock.Unlock()
+		return false
+	}
+	var prevLatLon []float64
+	var prevNavStatus int
+	var prevNavStatusSeen bool
+	if existed {
+		prevLatLon = prev.LatLon
+		prevNavStatus = prev.NavStatus
+		prevNavStatusSeen = prev.navStatusSeen
+	}
+	d.Ships.NewShip(p.Metadata.MMSI)
+	d.Ships.UpdateMetadata(p.Metadata, timestamp)
+	shipType := d.Ships.State[p.Metadata.MMSI].ShipType
+	d.Ships.StateLock.Unlock()
+
+	latLon := []float64{p.Metadata.Latitude, p.Metadata.Longitude}
+	if !existed {
+		d.Events.Publish(Event{Type: EVENT_NEW_SHIP, MMSI: p.Metadata.MMSI, Name: p.Metadata.ShipName, LatLon: latLon, Timestamp: timestamp})
+	}
+	d.geofenceEntries(p.Metadata.MMSI, p.Metadata.ShipName, prevLatLon, latLon, timestamp)
+
+	if d.ShipHistory {
+		if d.Ships.UpdateHistory(p.Metadata.MMSI, latLon, timestamp, d.HistoryLimits.For(shipType)) {
+			err = d.TrackStore.Append(p.Metadata.MMSI, latLon, timestamp)
+			if err != nil {
+				fmt.Printf("dock worker failed to append to track store: %s\n", err.Error())
 			}
+		}
+	}
 
-			d.Ships.UpdateMarker(p.Metadata.MMSI)
+	switch p.MsgType {
+	case "PositionReport":
+		d.Ships.UpdatePositionReport(p.Metadata.MMSI, p.Msg.PositionReport)
+
+		// A ship's first position report sets its nav status rather than changing it.
+		navStatus := p.Msg.PositionReport.NavigationalStatus
+		if prevNavStatusSeen && navStatus != prevNavStatus {
+			d.Events.Publish(Event{
+				Type:      EVENT_NAV_STATUS,
+				MMSI:      p.Metadata.MMSI,
+				Name:      p.Metadata.ShipName,
+				LatLon:    latLon,
+				Timestamp: timestamp,
+				NavStatus: &NavStatusChange{From: prevNavStatus, To: navStatus},
+			})
 		}
+	case "ShipStaticData":
+		d.Ships.UpdateShipStaticData(p.Metadata.MMSI, p.Msg.ShipStaticData, timestamp)
 	}
+
+	d.Ships.UpdateMarker(p.Metadata.MMSI)
+	d.Ships.Touch(p.Metadata.MMSI)
+	d.Live.Publish(p.Metadata.MMSI)
+
+	return true
 }
 
 func (s *Ships) NewShip(mmsi int) {
@@ -201,17 +388,18 @@ func (s *Ships) NewShip(mmsi int) {
 
 	s.HistoryLock.Lock()
 	if _, ok := s.History[mmsi]; !ok {
-		s.History[mmsi] = []History{}
+		s.History[mmsi] = NewHistoryBuffer(HistoryLimit{})
 	}
 	s.HistoryLock.Unlock()
 }
 
-func (s *Ships) UpdateMetadata(m aisstream.Metadata) {
+func (s *Ships) UpdateMetadata(m aisstream.Metadata, timestamp int64) {
 	s.State[m.MMSI].MMSI = m.MMSI
 	s.State[m.MMSI].Name = m.ShipName
 	s.State[m.MMSI].LatLon = []float64{m.Latitude, m.Longitude}
 	s.State[m.MMSI].Geohash = geohash.EncodeInt(s.State[m.MMSI].LatLon[0], s.State[m.MMSI].LatLon[1])
-	s.State[m.MMSI].LastUpdate = time.Now().Unix()
+	s.State[m.MMSI].LastUpdate = timestamp
+	s.Geo.Update(m.MMSI, s.State[m.MMSI].LatLon)
 }
 
 func (s *Ships) UpdatePositionReport(mmsi int, m aisstream.PositionReport) {
@@ -219,34 +407,45 @@ func (s *Ships) UpdatePositionReport(mmsi int, m aisstream.PositionReport) {
 	defer s.StateLock.Unlock()
 	s.State[mmsi].Heading = m.TrueHeading
 	s.State[mmsi].SOG = m.Sog
+	s.State[mmsi].COG = m.Cog
 	s.State[mmsi].NavStatus = m.NavigationalStatus
+	s.State[mmsi].navStatusSeen = true
 }
 
-func (s *Ships) UpdateShipStaticData(mmsi int, m aisstream.ShipStaticData) {
+func (s *Ships) UpdateShipStaticData(mmsi int, m aisstream.ShipStaticData, timestamp int64) {
 	s.StateLock.Lock()
 	s.State[mmsi].ShipType = m.Type
 	s.StateLock.Unlock()
 
 	s.InfoLock.Lock()
+	if s.Info[mmsi].Destination != m.Destination {
+		s.Info[mmsi].DestinationLocode, s.Info[mmsi].DestinationConfidence = NormalizeDestination(m.Destination)
+	}
 	s.Info[mmsi].Destination = m.Destination
+	s.Info[mmsi].ReportedEta = reportedEta(m.Eta.Month, m.Eta.Day, m.Eta.Hour, m.Eta.Minute, time.Unix(timestamp, 0).UTC())
 	s.Info[mmsi].IMONumber = m.ImoNumber
 	s.InfoLock.Unlock()
 }
 
-func NewHistory(latLon []float64) History {
+func NewHistory(latLon []float64, timestamp int64) History {
 	return History{
 		LatLon:    latLon,
-		Timestamp: time.Now().UTC().Unix(),
+		Timestamp: timestamp,
 	}
 }
 
-func (s *Ships) UpdateHistory(mmsi int, latLon []float64) {
+// UpdateHistory returns true if latLon was added to the ship's history, which is bounded by limit.
+func (s *Ships) UpdateHistory(mmsi int, latLon []float64, timestamp int64, limit HistoryLimit) bool {
 	s.HistoryLock.Lock()
 	defer s.HistoryLock.Unlock()
 
-	if len(s.History[mmsi]) == 0 || shipMoved(latLon, s.History[mmsi][0].LatLon) {
-		s.History[mmsi] = append([]History{NewHistory(latLon)}, s.History[mmsi]...) // Prepend new latLon to existing history
+	latest, ok := s.History[mmsi].Latest()
+	if !ok || shipMoved(latLon, latest.LatLon) {
+		s.History[mmsi].AddWithLimit(NewHistory(latLon, timestamp), limit)
+		return true
 	}
+
+	return false
 }
 
 // shipMoved attempts to determine whether a ship has moved since last update.
@@ -308,7 +507,9 @@ func (s *Ships) GetInfoWindow(mmsi int) (InfoWindow, error) {
 	infoWindow.ShipType = s.State[mmsi].ShipType
 	infoWindow.LastUpdate = s.State[mmsi].LastUpdate
 	infoWindow.Destination = s.Info[mmsi].Destination
+	infoWindow.DestinationLocode = s.Info[mmsi].DestinationLocode
 	infoWindow.IMONumber = s.Info[mmsi].IMONumber
+	infoWindow.Tags = s.State[mmsi].Tags
 
 	return infoWindow, nil
 }
@@ -320,7 +521,7 @@ func (s *Ships) GetShipHistory(mmsi int) ([]History, error) {
 	if history, ok := s.History[mmsi]; !ok {
 		return nil, fmt.Errorf("mmsi does not exist in ship history")
 	} else {
-		return history, nil
+		return history.Points(), nil
 	}
 }
 
@@ -335,55 +536,43 @@ func (s *Ships) GetShipDump() (map[int]*ShipDump, error) {
 	}
 	s.StateLock.RUnlock()
 
+	// Swabby removes state before info and history, skip ships that no longer have state.
 	s.InfoLock.RLock()
 	for k, v := range s.Info {
-		ships[k].Info = *v
-
+		if _, ok := ships[k]; ok {
+			ships[k].Info = *v
+		}
 	}
 	s.InfoLock.RUnlock()
 
 	s.HistoryLock.RLock()
 	for k, v := range s.History {
-		ships[k].History = v
-
+		if _, ok := ships[k]; ok {
+			ships[k].History = v.Points()
+		}
 	}
 	s.HistoryLock.RUnlock()
 
 	return ships, nil
 }
 
-func (s *Ships) GetShipsInBox(bbox [2][2]float64, geocache *Geocache) ([]*State, error) {
+func (s *Ships) GetShipsInBox(bbox [2][2]float64) ([]*State, error) {
 
 	if !validBbox(bbox) {
 		return nil, fmt.Errorf("bounding box out of range")
 	}
 
-	begin, end, err := geocache.BinarySearch(bbox)
-	if err != nil {
-		return nil, err
-	}
-
-	// If begin is greater than end, ship results should loop around geocache list.
-	var binaryShipResults []int
-	if begin > end {
-		for i := begin; i < len(geocache.List); i++ {
-			binaryShipResults = append(binaryShipResults, geocache.List[i].MMSI)
-		}
-		for i := 0; i <= end; i++ {
-			binaryShipResults = append(binaryShipResults, geocache.List[i].MMSI)
-		}
-	} else {
-		for i := begin; i <= end; i++ {
-			binaryShipResults = append(binaryShipResults, geocache.List[i].MMSI)
-		}
+	candidates := []int{}
+	for _, b := range splitBbox(bbox) {
+		candidates = append(candidates, s.Geo.Search(b)...)
 	}
 
 	shipsInCoords := make([]*State, 0)
 
 	s.StateLock.RLock()
-	for _, mmsi := range binaryShipResults {
-		ship := s.State[mmsi]
-		if ship.LatLon[0] >= bbox[0][0] && ship.LatLon[0] < bbox[1][0] && ship.LatLon[1] >= bbox[0][1] && ship.LatLon[1] < bbox[1][1] {
+	for _, mmsi := range candidates {
+		ship, ok := s.State[mmsi]
+		if ok && inBbox(ship.LatLon, bbox) {
 			shipsInCoords = append(shipsInCoords, ship)
 		}
 	}
@@ -392,7 +581,7 @@ func (s *Ships) GetShipsInBox(bbox [2][2]float64, geocache *Geocache) ([]*State,
 	return shipsInCoords, nil
 }
 
-func (s *Ships) GetShipsInBoxDebug(bbox [2][2]float64, geocache *Geocache) ([]*State, error) {
+func (s *Ships) GetShipsInBoxDebug(bbox [2][2]float64) ([]*State, error) {
 
 	if !validBbox(bbox) {
 		return nil, fmt.Errorf("bounding box out of range")
@@ -400,52 +589,35 @@ func (s *Ships) GetShipsInBoxDebug(bbox [2][2]float64, geocache *Geocache) ([]*S
 
 	totalTime := time.Now()
 
-	binaryTime := time.Now()
-
-	begin, end, err := geocache.BinarySearch(bbox)
-	if err != nil {
-		return nil, err
-	}
-
-	// If begin is greater than end, ship results should loop around geocache list.
-	var binaryShipResults []int
-	if begin > end {
-		for i := begin; i < len(geocache.List); i++ {
-			binaryShipResults = append(binaryShipResults, geocache.List[i].MMSI)
-		}
-		for i := 0; i <= end; i++ {
-			binaryShipResults = append(binaryShipResults, geocache.List[i].MMSI)
-		}
-	} else {
-		for i := begin; i <= end; i++ {
-			binaryShipResults = append(binaryShipResults, geocache.List[i].MMSI)
-		}
+	searchTime := time.Now()
+	candidates := []int{}
+	for _, b := range splitBbox(bbox) {
+		candidates = append(candidates, s.Geo.Search(b)...)
 	}
-	binaryElapsed := time.Since(binaryTime).Microseconds()
+	searchElapsed := time.Since(searchTime).Microseconds()
 
 	shipsInCoords := make([]*State, 0)
 
 	s.StateLock.RLock()
 
 	fineTime := time.Now()
-	for _, mmsi := range binaryShipResults {
-		ship := s.State[mmsi]
-		if ship.LatLon[0] >= bbox[0][0] && ship.LatLon[0] < bbox[1][0] && ship.LatLon[1] >= bbox[0][1] && ship.LatLon[1] < bbox[1][1] {
+	var results []int
+	for _, mmsi := range candidates {
+		ship, ok := s.State[mmsi]
+		if ok && inBbox(ship.LatLon, bbox) {
 			shipsInCoords = append(shipsInCoords, ship)
+			results = append(results, mmsi)
 		}
 	}
 	fineElapsed := time.Since(fineTime).Microseconds()
 
 	// This list contains all ships within the bbox by iterating over every one of them.
-	// Used to validate results from binary search.
-	// This should go into a debug function when moved into the seaspy program.
+	// Used to validate results from the geocache search.
 	controlTime := time.Now()
 	var controlList []int
 	for mmsi, ship := range s.State {
-		if ship.LatLon[0] >= bbox[0][0] && ship.LatLon[0] < bbox[1][0] && ship.LatLon[1] >= bbox[0][1] && ship.LatLon[1] < bbox[1][1] {
-			if ship.LastUpdate < geocache.LastUpdate {
-				controlList = append(controlList, mmsi)
-			}
+		if inBbox(ship.LatLon, bbox) {
+			controlList = append(controlList, mmsi)
 		}
 	}
 	controlElapsed := time.Since(controlTime).Microseconds()
@@ -456,17 +628,17 @@ func (s *Ships) GetShipsInBoxDebug(bbox [2][2]float64, geocache *Geocache) ([]*S
 
 	missing := 0
 	for _, mmsi := range controlList {
-		if !slices.Contains(binaryShipResults, mmsi) {
+		if !slices.Contains(results, mmsi) {
 			missing++
 		}
 	}
 	if missing > 0 {
-		fmt.Printf("of the %d binary results, %d from the control group are missing\n", len(binaryShipResults), missing)
+		fmt.Printf("of the %d geocache results, %d from the control group are missing\n", len(results), missing)
 	}
 
-	fmt.Printf("ships: %d, binary: %d, fine: %d, ctrl: %d, total: %d\n",
+	fmt.Printf("ships: %d, search: %d, fine: %d, ctrl: %d, total: %d\n",
 		len(shipsInCoords),
-		binaryElapsed,
+		searchElapsed,
 		fineElapsed,
 		controlElapsed,
 		totalElapsed,
@@ -475,6 +647,8 @@ func (s *Ships) GetShipsInBoxDebug(bbox [2][2]float64, geocache *Geocache) ([]*S
 	return shipsInCoords, nil
 }
 
+// validBbox checks the bbox is within range with its south west corner below its north east corner.
+// The south west longitude may be greater than the north east longitude when the bbox wraps the antimeridian.
 func validBbox(bbox [2][2]float64) bool {
 
 	if bbox[0][0] > LATMAX || bbox[0][0] < LATMIN || bbox[1][0] > LATMAX || bbox[1][0] < LATMIN {
@@ -485,5 +659,66 @@ func validBbox(bbox [2][2]float64) bool {
 		return false
 	}
 
+	if bbox[0][0] > bbox[1][0] {
+		return false
+	}
+
 	return true
 }
+
+func inBbox(latLon []float64, bbox [2][2]float64) bool {
+	if latLon[0] < bbox[0][0] || latLon[0] >= bbox[1][0] {
+		return false
+	}
+
+	if wrapsAntimeridian(bbox) {
+		return latLon[1] >= bbox[0][1] || latLon[1] < bbox[1][1]
+	}
+
+	// Positions on the antimeridian are included when the bbox extends to it.
+	return latLon[1] >= bbox[0][1] && (latLon[1] < bbox[1][1] || bbox[1][1] == LNGMAX)
+}
+
+func wrapsAntimeridian(bbox [2][2]float64) bool {
+	return bbox[0][1] > bbox[1][1]
+}
+
+// expandBbox widens bbox by dLat and dLon degrees on every side.
+// Latitudes are clamped to the poles and longitudes wrap across the antimeridian for splitBbox to handle.
+// A bbox widened to span every longitude covers LNGMIN to LNGMAX.
+func expandBbox(bbox [2][2]float64, dLat float64, dLon float64) [2][2]float64 {
+	width := bbox[1][1] - bbox[0][1]
+	if wrapsAntimeridian(bbox) {
+		width += 360
+	}
+
+	expanded := [2][2]float64{
+		{max(bbox[0][0]-dLat, LATMIN), LNGMIN},
+		{min(bbox[1][0]+dLat, LATMAX), LNGMAX},
+	}
+
+	if width+2*dLon < 360 {
+		expanded[0][1] = math.Mod(bbox[0][1]-dLon+540, 360) - 180
+		expanded[1][1] = math.Mod(bbox[1][1]+dLon+540, 360) - 180
+
+		// An east edge that lands on the antimeridian is kept as LNGMAX so the bbox does not wrap to an empty western half.
+		if expanded[1][1] == LNGMIN {
+			expanded[1][1] = LNGMAX
+		}
+	}
+
+	return expanded
+}
+
+// splitBbox splits a bbox that wraps the antimeridian into its eastern and western halves.
+// Bboxes that do not wrap are returned unchanged.
+func splitBbox(bbox [2][2]float64) [][2][2]float64 {
+	if !wrapsAntimeridian(bbox) {
+		return [][2][2]float64{bbox}
+	}
+
+	return [][2][2]float64{
+		{{bbox[0][0], bbox[0][1]}, {bbox[1][0], LNGMAX}},
+		{{bbox[0][0], LNGMIN}, {bbox[1][0], bbox[1][1]}},
+	}
+}
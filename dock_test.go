@@ -0,0 +1,239 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+func newTestShips(positions map[int][]float64) *Ships {
+	s := NewShips()
+	for mmsi, latLon := range positions {
+		s.State[mmsi] = &State{MMSI: mmsi, LatLon: latLon}
+		s.Geo.Update(mmsi, latLon)
+	}
+	return s
+}
+
+func shipsInBoxMMSIs(t *testing.T, s *Ships, bbox [2][2]float64) []int {
+	t.Helper()
+
+	ships, err := s.GetShipsInBox(bbox)
+	if err != nil {
+		t.Fatalf("GetShipsInBox(%v) failed: %s", bbox, err.Error())
+	}
+
+	mmsis := []int{}
+	for _, ship := range ships {
+		mmsis = append(mmsis, ship.MMSI)
+	}
+	slices.Sort(mmsis)
+
+	return mmsis
+}
+
+func TestGetShipsInBoxAntimeridian(t *testing.T) {
+	s := newTestShips(map[int][]float64{
+		1: {58.5, 178.2},   // Bering Sea, west of the antimeridian
+		2: {60.1, -172.4},  // Bering Sea, east of the antimeridian
+		3: {64.4, -165.4},  // Nome, outside the Bering Sea bbox
+		4: {-18.1, 178.4},  // Suva, Fiji
+		5: {-16.8, -179.9}, // Taveuni, Fiji, east of the antimeridian
+		6: {-17.7, 168.3},  // Port Vila, Vanuatu, outside the Fiji bbox
+		7: {51.9, 4.1},     // Rotterdam
+		8: {-17.0, 180.0},  // Exactly on the antimeridian
+	})
+
+	tests := []struct {
+		name string
+		bbox [2][2]float64
+		want []int
+	}{
+		{
+			name: "bering sea",
+			bbox: [2][2]float64{{52, 170}, {63, -168}},
+			want: []int{1, 2},
+		},
+		{
+			name: "fiji",
+			bbox: [2][2]float64{{-21, 176}, {-15, -178}},
+			want: []int{4, 5, 8},
+		},
+		{
+			name: "fiji west of the antimeridian only",
+			bbox: [2][2]float64{{-21, 176}, {-15, 179}},
+			want: []int{4},
+		},
+		{
+			name: "world",
+			bbox: [2][2]float64{{-90, -180}, {90, 180}},
+			want: []int{1, 2, 3, 4, 5, 6, 7, 8},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := shipsInBoxMMSIs(t, s, tt.bbox)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("GetShipsInBox(%v) = %v, want %v", tt.bbox, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidBbox(t *testing.T) {
+	tests := []struct {
+		name string
+		bbox [2][2]float64
+		want bool
+	}{
+		{"normal", [2][2]float64{{50, 0}, {55, 5}}, true},
+		{"wraps antimeridian", [2][2]float64{{52, 170}, {63, -168}}, true},
+		{"south west above north east", [2][2]float64{{63, 170}, {52, -168}}, false},
+		{"longitude out of range", [2][2]float64{{52, 170}, {63, 190}}, false},
+		{"latitude out of range", [2][2]float64{{-91, 0}, {10, 10}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validBbox(tt.bbox); got != tt.want {
+				t.Errorf("validBbox(%v) = %v, want %v", tt.bbox, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandBbox(t *testing.T) {
+	tests := []struct {
+		name string
+		bbox [2][2]float64
+		dLat float64
+		dLon float64
+		want [2][2]float64
+	}{
+		{
+			name: "inside",
+			bbox: [2][2]float64{{50, 0}, {52, 4}},
+			dLat: 1, dLon: 1,
+			want: [2][2]float64{{49, -1}, {53, 5}},
+		},
+		{
+			name: "wraps east",
+			bbox: [2][2]float64{{50, 170}, {52, 179.5}},
+			dLat: 1, dLon: 1,
+			want: [2][2]float64{{49, 169}, {53, -179.5}},
+		},
+		{
+			name: "wraps west",
+			bbox: [2][2]float64{{50, -179.5}, {52, -170}},
+			dLat: 1, dLon: 1,
+			want: [2][2]float64{{49, 179.5}, {53, -169}},
+		},
+		{
+			name: "already wrapping",
+			bbox: [2][2]float64{{50, 178}, {52, -178}},
+			dLat: 1, dLon: 1,
+			want: [2][2]float64{{49, 177}, {53, -177}},
+		},
+		{
+			name: "east edge on antimeridian",
+			bbox: [2][2]float64{{50, 170}, {52, 179}},
+			dLat: 1, dLon: 1,
+			want: [2][2]float64{{49, 169}, {53, LNGMAX}},
+		},
+		{
+			name: "poles clamped",
+			bbox: [2][2]float64{{-89.5, 0}, {89.5, 4}},
+			dLat: 1, dLon: 1,
+			want: [2][2]float64{{LATMIN, -1}, {LATMAX, 5}},
+		},
+		{
+			name: "spans every longitude",
+			bbox: [2][2]float64{{50, -179}, {52, 179}},
+			dLat: 1, dLon: 1,
+			want: [2][2]float64{{49, LNGMIN}, {53, LNGMAX}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := expandBbox(tt.bbox, tt.dLat, tt.dLon)
+			if got != tt.want {
+				t.Errorf("expandBbox(%v, %v, %v) = %v, want %v", tt.bbox, tt.dLat, tt.dLon, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNavStatusEvents(t *testing.T) {
+	const mmsi = 244000001
+
+	packet := func(msgType string, navStatus int) []byte {
+		return []byte(fmt.Sprintf(`{"MessageType":%q,"Metadata":{"MMSI":%d,"ShipName":"TEST","latitude":51.9,"longitude":4.1},"Message":{"PositionReport":{"NavigationalStatus":%d}}}`, msgType, mmsi, navStatus))
+	}
+
+	tests := []struct {
+		name    string
+		packets [][]byte
+		want    []NavStatusChange
+	}{
+		{
+			name:    "first report",
+			packets: [][]byte{packet("PositionReport", 5)},
+			want:    []NavStatusChange{},
+		},
+		{
+			name:    "unchanged",
+			packets: [][]byte{packet("PositionReport", 0), packet("PositionReport", 0)},
+			want:    []NavStatusChange{},
+		},
+		{
+			name:    "moored then under way",
+			packets: [][]byte{packet("PositionReport", 5), packet("PositionReport", 5), packet("PositionReport", 0)},
+			want:    []NavStatusChange{{From: 5, To: 0}},
+		},
+		{
+			name:    "from not defined",
+			packets: [][]byte{packet("PositionReport", NAV_STATUS_NOT_DEFINED), packet("PositionReport", 0)},
+			want:    []NavStatusChange{{From: NAV_STATUS_NOT_DEFINED, To: 0}},
+		},
+		{
+			name:    "to not defined",
+			packets: [][]byte{packet("PositionReport", 0), packet("PositionReport", NAV_STATUS_NOT_DEFINED)},
+			want:    []NavStatusChange{{From: 0, To: NAV_STATUS_NOT_DEFINED}},
+		},
+		{
+			name:    "static data first",
+			packets: [][]byte{packet("ShipStaticData", 0), packet("PositionReport", 1)},
+			want:    []NavStatusChange{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &Dock{
+				Ships:      NewShips(),
+				TrackStore: NewTrackStore(Tracks{}),
+				Live:       NewLiveFeed(),
+				Events:     NewEventBus(),
+			}
+			c := d.Events.Subscribe(EventFilter{Types: map[string]bool{EVENT_NAV_STATUS: true}})
+
+			now := time.Now().Unix()
+			for i, p := range tt.packets {
+				if !d.Process(p, now+int64(i)) {
+					t.Fatalf("Process(%s) rejected the packet", p)
+				}
+			}
+
+			got := []NavStatusChange{}
+			for len(c) > 0 {
+				got = append(got, *(<-c).NavStatus)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("nav status events = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
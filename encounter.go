@@ -0,0 +1,279 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+)
+
+const (
+	ENCOUNTER_MAX_BBOX_DEGREES = 10
+	ENCOUNTER_MAX_SHIPS        = 2000
+)
+
+// errEncounterLimit is returned for bbox encounter searches exceeding ENCOUNTER_MAX_BBOX_DEGREES or ENCOUNTER_MAX_SHIPS,
+// as every ship in the bbox searches its own neighbours.
+var errEncounterLimit = errors.New("encounter search limit exceeded")
+
+// Encounter holds the thresholds used when computing closest point of approach (CPA) between vessels.
+// Neighbours are gathered from the geocache within SearchRadiusNm of each vessel.
+type Encounter struct {
+	MaxCPANm       float64 `json:"maxCpaNm"`
+	MaxTCPAMinutes float64 `json:"maxTcpaMinutes"`
+	SearchRadiusNm float64 `json:"searchRadiusNm"`
+	MaxAgeMinutes  int     `json:"maxAgeMinutes"`
+	MaxResults     int     `json:"maxResults"`
+}
+
+// EncounterRisk describes the projected closest approach between two vessels.
+type EncounterRisk struct {
+	MMSI        int       `json:"mmsi"`
+	Name        string    `json:"name"`
+	LatLon      []float64 `json:"latlon"`
+	Other       int       `json:"other"`
+	OtherName   string    `json:"otherName"`
+	OtherLatLon []float64 `json:"otherLatlon"`
+	DistanceNm  float64   `json:"distanceNm"`
+	CPANm       float64   `json:"cpaNm"`
+	TCPAMinutes float64   `json:"tcpaMinutes"`
+}
+
+func NewEncounterDefaults() Encounter {
+	return Encounter{
+		MaxCPANm:       1.0,
+		MaxTCPAMinutes: 30,
+		SearchRadiusNm: 12,
+		MaxAgeMinutes:  10,
+		MaxResults:     50,
+	}
+}
+
+// GetShipEncounters returns the encounters between mmsi and its neighbours that fall within the configured CPA and TCPA thresholds.
+func (s *Ships) GetShipEncounters(mmsi int, e Encounter) ([]EncounterRisk, error) {
+	s.StateLock.RLock()
+	ship, ok := s.State[mmsi]
+	var own State
+	if ok {
+		own = *ship
+	}
+	s.StateLock.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("mmsi does not exist in ship state")
+	}
+
+	risks, err := s.encounters(own, e)
+	if err != nil {
+		return nil, err
+	}
+
+	sortEncounters(risks)
+	return limitEncounters(risks, e.MaxResults), nil
+}
+
+// GetEncountersInBox returns the riskiest encounters involving at least one vessel inside bbox.
+// Each vessel pair is only reported once. Bboxes spanning more than ENCOUNTER_MAX_BBOX_DEGREES or holding more than ENCOUNTER_MAX_SHIPS are rejected.
+func (s *Ships) GetEncountersInBox(bbox [2][2]float64, e Encounter) ([]EncounterRisk, error) {
+	width := bbox[1][1] - bbox[0][1]
+	if wrapsAntimeridian(bbox) {
+		width += 360
+	}
+
+	if width > ENCOUNTER_MAX_BBOX_DEGREES || bbox[1][0]-bbox[0][0] > ENCOUNTER_MAX_BBOX_DEGREES {
+		return nil, fmt.Errorf("%w: bbox spans more than %d degrees", errEncounterLimit, ENCOUNTER_MAX_BBOX_DEGREES)
+	}
+
+	ships, err := s.GetShipsInBox(bbox)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ships) > ENCOUNTER_MAX_SHIPS {
+		return nil, fmt.Errorf("%w: bbox holds more than %d ships", errEncounterLimit, ENCOUNTER_MAX_SHIPS)
+	}
+
+	s.StateLock.RLock()
+	candidates := make([]State, 0, len(ships))
+	for _, ship := range ships {
+		candidates = append(candidates, *ship)
+	}
+	s.StateLock.RUnlock()
+
+	seen := make(map[[2]int]bool)
+	risks := make([]EncounterRisk, 0)
+
+	for _, own := range candidates {
+		shipRisks, err := s.encounters(own, e)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, r := range shipRisks {
+			pair := [2]int{min(r.MMSI, r.Other), max(r.MMSI, r.Other)}
+			if seen[pair] {
+				continue
+			}
+			seen[pair] = true
+			risks = append(risks, r)
+		}
+	}
+
+	sortEncounters(risks)
+	return limitEncounters(risks, e.MaxResults), nil
+}
+
+// encounters computes CPA and TCPA between own and every neighbour found within the search radius.
+func (s *Ships) encounters(own State, e Encounter) ([]EncounterRisk, error) {
+	risks := make([]EncounterRisk, 0)
+
+	now := time.Now().Unix()
+	if !encounterCandidate(own, e, now) {
+		return risks, nil
+	}
+
+	neighbours, err := s.GetShipsInRadius(own.LatLon, e.SearchRadiusNm)
+	if err != nil {
+		return nil, err
+	}
+
+	s.StateLock.RLock()
+	others := make([]State, 0, len(neighbours))
+	for _, ship := range neighbours {
+		if ship.MMSI != own.MMSI {
+			others = append(others, *ship)
+		}
+	}
+	s.StateLock.RUnlock()
+
+	for _, other := range others {
+		if !encounterCandidate(other, e, now) {
+			continue
+		}
+
+		cpa, tcpa, ok := closestApproach(own, other)
+		if !ok || cpa > e.MaxCPANm || tcpa*60 > e.MaxTCPAMinutes {
+			continue
+		}
+
+		risks = append(risks, EncounterRisk{
+			MMSI:        own.MMSI,
+			Name:        own.Name,
+			LatLon:      own.LatLon,
+			Other:       other.MMSI,
+			OtherName:   other.Name,
+			OtherLatLon: other.LatLon,
+			DistanceNm:  distanceNm(own.LatLon, other.LatLon),
+			CPANm:       cpa,
+			TCPAMinutes: tcpa * 60,
+		})
+	}
+
+	return risks, nil
+}
+
+// encounterCandidate excludes ships without a position or whose last report is older than MaxAgeMinutes.
+func encounterCandidate(ship State, e Encounter, now int64) bool {
+	if len(ship.LatLon) != 2 {
+		return false
+	}
+
+	if e.MaxAgeMinutes > 0 && now-ship.LastUpdate > int64(e.MaxAgeMinutes*60) {
+		return false
+	}
+
+	return true
+}
+
+// closestApproach returns the CPA in nautical miles and TCPA in hours between two ships.
+// Positions are projected onto a local flat plane centred on a, which is accurate for the short ranges involved.
+// The boolean is false when the ships are not converging or either ship's velocity is not available.
+func closestApproach(a State, b State) (float64, float64, bool) {
+	// Take the short way round when the ships are either side of the antimeridian.
+	dLon := math.Mod(b.LatLon[1]-a.LatLon[1]+540, 360) - 180
+	px := dLon * 60 * math.Cos(radians(a.LatLon[0]))
+	py := (b.LatLon[0] - a.LatLon[0]) * 60
+
+	avx, avy, ok := velocity(a)
+	if !ok {
+		return 0, 0, false
+	}
+
+	bvx, bvy, ok := velocity(b)
+	if !ok {
+		return 0, 0, false
+	}
+
+	vx := bvx - avx
+	vy := bvy - avy
+
+	v2 := vx*vx + vy*vy
+	if v2 == 0 {
+		return 0, 0, false
+	}
+
+	tcpa := -(px*vx + py*vy) / v2
+	if tcpa < 0 {
+		return 0, 0, false
+	}
+
+	cx := px + vx*tcpa
+	cy := py + vy*tcpa
+
+	return math.Sqrt(cx*cx + cy*cy), tcpa, true
+}
+
+// velocity returns the east and north components of a ship's velocity in knots.
+// Ships reporting a negligible speed are treated as stationary.
+// Returns false if the ship's speed or course is not available, as its velocity is then unknown.
+func velocity(ship State) (float64, float64, bool) {
+	if ship.SOG >= SOG_NOT_AVAILABLE || ship.COG >= COG_NOT_AVAILABLE {
+		return 0, 0, false
+	}
+
+	if ship.SOG <= MOVING_SPEED_THRESHOLD {
+		return 0, 0, true
+	}
+
+	return ship.SOG * math.Sin(radians(ship.COG)), ship.SOG * math.Cos(radians(ship.COG)), true
+}
+
+// radiusBbox returns a bounding box enclosing a circle of radiusNm around latLon.
+// Latitudes are clamped to valid coordinates while longitudes wrap, so the bbox wraps the antimeridian when the circle crosses it.
+func radiusBbox(latLon []float64, radiusNm float64) [2][2]float64 {
+	dLat := radiusNm / 60
+	dLon := LNGMAX
+	if cos := math.Cos(radians(latLon[0])); cos > 0 {
+		dLon = math.Min(LNGMAX, radiusNm/(60*cos))
+	}
+
+	if dLon >= LNGMAX {
+		return [2][2]float64{
+			{math.Max(LATMIN, latLon[0]-dLat), LNGMIN},
+			{math.Min(LATMAX, latLon[0]+dLat), LNGMAX},
+		}
+	}
+
+	return [2][2]float64{
+		{math.Max(LATMIN, latLon[0]-dLat), math.Mod(latLon[1]-dLon+540, 360) - 180},
+		{math.Min(LATMAX, latLon[0]+dLat), math.Mod(latLon[1]+dLon+540, 360) - 180},
+	}
+}
+
+func sortEncounters(risks []EncounterRisk) {
+	slices.SortFunc(risks, func(a, b EncounterRisk) int {
+		if a.CPANm != b.CPANm {
+			return cmp.Compare(a.CPANm, b.CPANm)
+		}
+		return cmp.Compare(a.TCPAMinutes, b.TCPAMinutes)
+	})
+}
+
+func limitEncounters(risks []EncounterRisk, limit int) []EncounterRisk {
+	if limit > 0 && len(risks) > limit {
+		return risks[:limit]
+	}
+	return risks
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestRadiusBboxAntimeridian(t *testing.T) {
+	s := newTestShips(map[int][]float64{
+		1: {-17.0, 179.95},
+		2: {-17.0, -179.95},
+		3: {-17.0, 179.0},
+	})
+
+	got := shipsInBoxMMSIs(t, s, radiusBbox([]float64{-17.0, 179.95}, 12))
+	want := []int{1, 2}
+	if !slices.Equal(got, want) {
+		t.Errorf("ships within 12nm of the antimeridian = %v, want %v", got, want)
+	}
+}
+
+func TestClosestApproach(t *testing.T) {
+	// b starts 6 nm north of a, so head on ships meet in half an hour at a closing speed of 12 knots.
+	a := State{LatLon: []float64{50, 0}, SOG: 6, COG: 0}
+	b := State{LatLon: []float64{50.1, 0}, SOG: 6, COG: 180}
+
+	tests := []struct {
+		name     string
+		a, b     State
+		wantTCPA float64
+		wantOK   bool
+	}{
+		{name: "head on", a: a, b: b, wantTCPA: 0.5, wantOK: true},
+		{name: "stationary", a: a, b: State{LatLon: b.LatLon, SOG: 0, COG: 0}, wantTCPA: 1, wantOK: true},
+		{name: "diverging", a: a, b: State{LatLon: b.LatLon, SOG: 12, COG: 0}, wantOK: false},
+		{name: "speed not available", a: a, b: State{LatLon: b.LatLon, SOG: SOG_NOT_AVAILABLE, COG: 180}, wantOK: false},
+		{name: "course not available", a: a, b: State{LatLon: b.LatLon, SOG: 6, COG: COG_NOT_AVAILABLE}, wantOK: false},
+		{name: "own course not available", a: State{LatLon: a.LatLon, SOG: 6, COG: COG_NOT_AVAILABLE}, b: b, wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cpa, tcpa, ok := closestApproach(tt.a, tt.b)
+			if ok != tt.wantOK {
+				t.Fatalf("closestApproach() ok = %v, want %v", ok, tt.wantOK)
+			}
+
+			if ok && (cpa > 1e-9 || math.Abs(tcpa-tt.wantTCPA) > 1e-9) {
+				t.Errorf("closestApproach() = %v nm in %v h, want 0 nm in %v h", cpa, tcpa, tt.wantTCPA)
+			}
+		})
+	}
+}
+
+func TestGetShipEncountersRadius(t *testing.T) {
+	e := Encounter{MaxCPANm: 1, MaxTCPAMinutes: 60, SearchRadiusNm: 12, MaxResults: 50}
+
+	tests := []struct {
+		name  string
+		cog   float64
+		other []float64
+		want  []int
+	}{
+		// Both others lie inside the search bbox, the corner one is 15 nm away and outside the search radius.
+		{name: "within radius", cog: 0, other: []float64{50.16, 0}, want: []int{2}},
+		{name: "bbox corner", cog: 45, other: []float64{50.18, 0.28}, want: []int{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestShips(map[int][]float64{1: {50, 0}, 2: tt.other})
+			s.State[1].SOG = 30
+			s.State[1].COG = tt.cog
+			s.State[2].COG = COG_NOT_AVAILABLE - 1
+
+			risks, err := s.GetShipEncounters(1, e)
+			if err != nil {
+				t.Fatalf("GetShipEncounters failed: %s", err.Error())
+			}
+
+			got := []int{}
+			for _, r := range risks {
+				got = append(got, r.Other)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("GetShipEncounters(1) = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetEncountersInBoxLimits(t *testing.T) {
+	crowded := map[int][]float64{}
+	for i := range ENCOUNTER_MAX_SHIPS + 1 {
+		crowded[i+1] = []float64{50 + float64(i%50)*0.01, float64(i/50) * 0.01}
+	}
+	s := newTestShips(crowded)
+
+	tests := []struct {
+		name    string
+		bbox    [2][2]float64
+		wantErr bool
+	}{
+		{name: "harbour", bbox: [2][2]float64{{49.9, -0.1}, {50.05, 0.05}}},
+		{name: "too many ships", bbox: [2][2]float64{{49, -1}, {52, 1}}, wantErr: true},
+		{name: "too wide", bbox: [2][2]float64{{0, -20}, {5, 20}}, wantErr: true},
+		{name: "too wide across the antimeridian", bbox: [2][2]float64{{0, 170}, {5, -170}}, wantErr: true},
+		{name: "too tall", bbox: [2][2]float64{{-10, 100}, {10, 101}}, wantErr: true},
+		{name: "narrow across the antimeridian", bbox: [2][2]float64{{0, 178}, {5, -178}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.GetEncountersInBox(tt.bbox, NewEncounterDefaults())
+			if tt.wantErr != errors.Is(err, errEncounterLimit) {
+				t.Errorf("GetEncountersInBox(%v) error = %v, want limit error %v", tt.bbox, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Eta configures arrival time prediction.
+// RouteFactor scales great-circle distance to approximate the longer distance sailed along sea lanes.
+// LearnedWeight is the share of the predicted speed taken from the ship's past voyages, the remainder comes from its current speed.
+type Eta struct {
+	RouteFactor   float64 `json:"routeFactor"`
+	LearnedWeight float64 `json:"learnedWeight"`
+	MinSpeed      float64 `json:"minSpeed"`
+}
+
+// EtaPrediction compares the predicted time of arrival at the normalized destination with the ETA reported by the ship.
+// Predicted is 0 when no prediction could be made and Reported is 0 when the ship does not report an ETA.
+type EtaPrediction struct {
+	Destination string  `json:"destination"`
+	DistanceNm  float64 `json:"distanceNm"`
+	SpeedKn     float64 `json:"speedKn"`
+	Predicted   int64   `json:"predicted"`
+	Reported    int64   `json:"reported"`
+}
+
+func NewEtaDefaults() Eta {
+	return Eta{
+		RouteFactor:   1.15,
+		LearnedWeight: 0.5,
+		MinSpeed:      1,
+	}
+}
+
+// PredictEta estimates the arrival time of a ship at its normalized destination.
+// The speed used is a blend of the ship's current speed and the average speed of its completed voyages.
+func (s *Ships) PredictEta(mmsi int, e Eta, v Voyage) (EtaPrediction, error) {
+	var prediction EtaPrediction
+
+	s.StateLock.RLock()
+	ship, ok := s.State[mmsi]
+	var state State
+	if ok {
+		state = *ship
+	}
+	s.StateLock.RUnlock()
+
+	if !ok {
+		return prediction, fmt.Errorf("mmsi does not exist in ship state")
+	}
+
+	s.InfoLock.RLock()
+	info, ok := s.Info[mmsi]
+	if ok {
+		prediction.Destination = info.DestinationLocode
+		prediction.Reported = info.ReportedEta
+	}
+	s.InfoLock.RUnlock()
+
+	if !ok {
+		return prediction, fmt.Errorf("mmsi does not exist in ship info")
+	}
+
+	port, ok := Ports[prediction.Destination]
+	if !ok || len(state.LatLon) != 2 {
+		return prediction, nil
+	}
+
+	prediction.DistanceNm = distanceNm(state.LatLon, port.LatLon) * e.RouteFactor
+
+	voyages, err := s.GetShipVoyages(mmsi, v)
+	if err != nil {
+		return prediction, err
+	}
+
+	prediction.SpeedKn = e.speed(state.SOG, voyages)
+	if prediction.SpeedKn < e.MinSpeed || prediction.SpeedKn <= 0 {
+		prediction.SpeedKn = 0
+		return prediction, nil
+	}
+
+	hours := prediction.DistanceNm / prediction.SpeedKn
+	prediction.Predicted = time.Now().UTC().Add(time.Duration(hours * float64(time.Hour))).Unix()
+
+	return prediction, nil
+}
+
+// speed blends the current speed over ground with the distance weighted average speed of completed voyages.
+// Either source is used alone when the other is unavailable.
+func (e Eta) speed(sog float64, voyages []ShipVoyage) float64 {
+	var distance, hours float64
+	for _, voyage := range voyages {
+		if voyage.Underway || voyage.Arrival <= voyage.Departure {
+			continue
+		}
+		distance += voyage.DistanceNm
+		hours += float64(voyage.Arrival-voyage.Departure) / 3600
+	}
+
+	current := sog
+	if current >= SOG_NOT_AVAILABLE || current < e.MinSpeed {
+		current = 0
+	}
+
+	if hours == 0 {
+		return current
+	}
+
+	learned := distance / hours
+	if current == 0 {
+		return learned
+	}
+
+	return e.LearnedWeight*learned + (1-e.LearnedWeight)*current
+}
+
+// reportedEta converts the month, day, hour and minute of an AIS ETA into a unix timestamp.
+// AIS does not carry a year, so the ETA is placed in the current year unless that is more than six months in the past.
+// Returns 0 when any field holds its "not available" value (month 0, day 0, hour 24, minute 60) or is out of range,
+// including days past the end of the month which time.Date would otherwise carry into the next month.
+// Reference: https://www.navcen.uscg.gov/ais-class-a-static-voyage-message-5
+func reportedEta(month int, day int, hour int, minute int, now time.Time) int64 {
+	if month < 1 || month > 12 || day < 1 || day > 31 || hour < 0 || hour > 23 || minute < 0 || minute > 59 {
+		return 0
+	}
+
+	year := now.Year()
+	if now.Sub(time.Date(year, time.Month(month), day, hour, minute, 0, 0, time.UTC)) > 183*24*time.Hour {
+		year++
+	}
+
+	eta := time.Date(year, time.Month(month), day, hour, minute, 0, 0, time.UTC)
+	if eta.Month() != time.Month(month) || eta.Day() != day {
+		return 0
+	}
+
+	return eta.Unix()
+}
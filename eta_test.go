@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReportedEta(t *testing.T) {
+	now := time.Date(2023, 10, 15, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name                     string
+		month, day, hour, minute int
+		want                     time.Time
+	}{
+		{name: "this year", month: 10, day: 20, hour: 6, minute: 30, want: time.Date(2023, 10, 20, 6, 30, 0, 0, time.UTC)},
+		{name: "recently passed", month: 9, day: 1, hour: 0, minute: 0, want: time.Date(2023, 9, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "next year", month: 1, day: 5, hour: 12, minute: 0, want: time.Date(2024, 1, 5, 12, 0, 0, 0, time.UTC)},
+		{name: "leap day next year", month: 2, day: 29, hour: 0, minute: 0, want: time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{name: "month not available", month: 0, day: 20, hour: 6, minute: 30},
+		{name: "day not available", month: 10, day: 0, hour: 6, minute: 30},
+		{name: "hour not available", month: 10, day: 20, hour: 24, minute: 30},
+		{name: "minute not available", month: 10, day: 20, hour: 6, minute: 60},
+		{name: "month out of range", month: 13, day: 20, hour: 6, minute: 30},
+		{name: "day out of range", month: 10, day: 32, hour: 6, minute: 30},
+		{name: "past end of month", month: 11, day: 31, hour: 6, minute: 30},
+		{name: "february 30", month: 2, day: 30, hour: 6, minute: 30},
+		{name: "negative hour", month: 10, day: 20, hour: -1, minute: 30},
+		{name: "negative minute", month: 10, day: 20, hour: 6, minute: -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var want int64
+			if !tt.want.IsZero() {
+				want = tt.want.Unix()
+			}
+
+			got := reportedEta(tt.month, tt.day, tt.hour, tt.minute, now)
+			if got != want {
+				t.Errorf("reportedEta(%d, %d, %d, %d) = %d, want %d", tt.month, tt.day, tt.hour, tt.minute, got, want)
+			}
+		})
+	}
+}
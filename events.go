@@ -0,0 +1,148 @@
+package main
+
+import (
+	"slices"
+	"sync"
+)
+
+const (
+	EVENT_NEW_SHIP       = "newShip"
+	EVENT_SHIP_REMOVED   = "shipRemoved"
+	EVENT_NAV_STATUS     = "navStatus"
+	EVENT_GEOFENCE_ENTRY = "geofenceEntry"
+	EVENT_ALERT          = "alert"
+
+	EVENT_BUFFER            = 256
+	EVENT_KEEPALIVE_SECONDS = 15
+)
+
+// Geofence is a named polygon of lat, lon vertices, ships crossing into it raise a geofence entry event.
+type Geofence struct {
+	Name    string      `json:"name"`
+	Polygon [][]float64 `json:"polygon"`
+	bbox    [2][2]float64
+}
+
+// Event is a change to the fleet streamed to event subscribers.
+// Geofence is set for geofence entries, Alert holds the behaviour tag raised for alerts and NavStatus the change for nav status events.
+type Event struct {
+	Type      string           `json:"type"`
+	MMSI      int              `json:"mmsi"`
+	Name      string           `json:"name"`
+	LatLon    []float64        `json:"latlon"`
+	Timestamp int64            `json:"timestamp"`
+	Geofence  string           `json:"geofence,omitempty"`
+	Alert     string           `json:"alert,omitempty"`
+	NavStatus *NavStatusChange `json:"navStatus,omitempty"`
+}
+
+type NavStatusChange struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+// EventFilter selects the events sent to a subscriber. Empty sets and a nil Bbox match every event.
+type EventFilter struct {
+	Types map[string]bool
+	MMSIs map[int]bool
+	Bbox  *[2][2]float64
+}
+
+// EventBus fans events out to subscribers without blocking publishers.
+// Events are dropped for subscribers whose buffer of EVENT_BUFFER events is full.
+type EventBus struct {
+	Lock        sync.RWMutex
+	subscribers map[chan Event]EventFilter
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{
+		subscribers: map[chan Event]EventFilter{},
+	}
+}
+
+func (b *EventBus) Subscribe(f EventFilter) chan Event {
+	c := make(chan Event, EVENT_BUFFER)
+
+	b.Lock.Lock()
+	b.subscribers[c] = f
+	b.Lock.Unlock()
+
+	return c
+}
+
+func (b *EventBus) Unsubscribe(c chan Event) {
+	b.Lock.Lock()
+	delete(b.subscribers, c)
+	b.Lock.Unlock()
+}
+
+func (b *EventBus) Publish(e Event) {
+	b.Lock.RLock()
+	defer b.Lock.RUnlock()
+
+	for c, f := range b.subscribers {
+		if !f.Match(e) {
+			continue
+		}
+
+		select {
+		case c <- e:
+		default:
+		}
+	}
+}
+
+func (f EventFilter) Match(e Event) bool {
+	if len(f.Types) > 0 && !f.Types[e.Type] {
+		return false
+	}
+
+	if len(f.MMSIs) > 0 && !f.MMSIs[e.MMSI] {
+		return false
+	}
+
+	if f.Bbox != nil && (len(e.LatLon) != 2 || !inBbox(e.LatLon, *f.Bbox)) {
+		return false
+	}
+
+	return true
+}
+
+// geofenceEntries publishes an entry event for every geofence that latLon is inside and prev was not.
+// Ships seen for the first time have no previous position and are not considered to have entered.
+func (d *Dock) geofenceEntries(mmsi int, name string, prev []float64, latLon []float64, timestamp int64) {
+	if len(prev) != 2 {
+		return
+	}
+
+	for _, g := range d.Geofences {
+		if !inBbox(latLon, g.bbox) || !pointInPolygon(latLon, g.Polygon) {
+			continue
+		}
+
+		if inBbox(prev, g.bbox) && pointInPolygon(prev, g.Polygon) {
+			continue
+		}
+
+		d.Events.Publish(Event{
+			Type:      EVENT_GEOFENCE_ENTRY,
+			MMSI:      mmsi,
+			Name:      name,
+			LatLon:    latLon,
+			Timestamp: timestamp,
+			Geofence:  g.Name,
+		})
+	}
+}
+
+// newTags returns the tags in t that are not in current.
+func newTags(current []string, t []string) []string {
+	added := []string{}
+	for _, tag := range t {
+		if !slices.Contains(current, tag) {
+			added = append(added, tag)
+		}
+	}
+	return added
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ShipFilter narrows a ship list by attribute. Empty sets and zero values match every ship.
+// Ships with an unavailable speed never match a speed range, and ships without a known flag state never match Flags.
+type ShipFilter struct {
+	Groups        map[int]bool
+	Types         map[int]bool
+	NavStatus     map[int]bool
+	Flags         map[string]bool
+	MinSOG        float64
+	MaxSOG        float64
+	MaxAgeSeconds int64
+	Named         *bool
+}
+
+// Active reports whether the filter excludes any ships.
+func (f ShipFilter) Active() bool {
+	return len(f.Groups) > 0 || len(f.Types) > 0 || len(f.NavStatus) > 0 || len(f.Flags) > 0 ||
+		f.MinSOG > 0 || f.MaxSOG > 0 || f.MaxAgeSeconds > 0 || f.Named != nil
+}
+
+// Match reports whether ship passes every condition of the filter.
+func (f ShipFilter) Match(ship State, now int64) bool {
+	if len(f.Groups) > 0 {
+		class, ok := ShipTypes[ship.ShipType]
+		if !ok || !f.Groups[class.GroupId] {
+			return false
+		}
+	}
+
+	if len(f.Types) > 0 && !f.Types[ship.ShipType] {
+		return false
+	}
+
+	if len(f.NavStatus) > 0 && !f.NavStatus[ship.NavStatus] {
+		return false
+	}
+
+	if len(f.Flags) > 0 {
+		flag, ok := flagState(ship.MMSI)
+		if !ok || !f.Flags[flag] {
+			return false
+		}
+	}
+
+	if f.MinSOG > 0 || f.MaxSOG > 0 {
+		if ship.SOG >= SOG_NOT_AVAILABLE || ship.SOG < f.MinSOG {
+			return false
+		}
+		if f.MaxSOG > 0 && ship.SOG > f.MaxSOG {
+			return false
+		}
+	}
+
+	if f.MaxAgeSeconds > 0 && now-ship.LastUpdate > f.MaxAgeSeconds {
+		return false
+	}
+
+	if f.Named != nil && *f.Named != (strings.TrimSpace(ship.Name) != "") {
+		return false
+	}
+
+	return true
+}
+
+// FilterShips returns the ships matching f.
+func (s *Ships) FilterShips(ships []*State, f ShipFilter) []*State {
+	if !f.Active() {
+		return ships
+	}
+
+	now := time.Now().Unix()
+	filtered := make([]*State, 0, len(ships))
+
+	s.StateLock.RLock()
+	for _, ship := range ships {
+		if f.Match(*ship, now) {
+			filtered = append(filtered, ship)
+		}
+	}
+	s.StateLock.RUnlock()
+
+	return filtered
+}
+
+// flagState returns the flag state of a ship from the Maritime Identification Digits in its mmsi.
+// Besides ship stations (MIDXXXXXX) the MID is found in handheld (8MIDXXXXX), SAR aircraft (111MIDXXX),
+// craft associated with a parent ship (98MIDXXXX) and aids to navigation (99MIDXXXX) mmsis.
+func flagState(mmsi int) (string, bool) {
+	digits := strconv.Itoa(mmsi)
+	if len(digits) != 9 {
+		return "", false
+	}
+
+	var mid string
+	switch {
+	case strings.HasPrefix(digits, "111"):
+		mid = digits[3:6]
+	case strings.HasPrefix(digits, "98"), strings.HasPrefix(digits, "99"):
+		mid = digits[2:5]
+	case strings.HasPrefix(digits, "8"):
+		mid = digits[1:4]
+	default:
+		mid = digits[0:3]
+	}
+
+	m, err := strconv.Atoi(mid)
+	if err != nil {
+		return "", false
+	}
+
+	flag, ok := MIDFlags[m]
+	return flag, ok
+}
@@ -0,0 +1,63 @@
+package main
+
+import "testing"
+
+func TestFlagState(t *testing.T) {
+	tests := []struct {
+		name   string
+		mmsi   int
+		want   string
+		wantOk bool
+	}{
+		{name: "ship station", mmsi: 244123456, want: "NL", wantOk: true},
+		{name: "ship station us", mmsi: 366999999, want: "US", wantOk: true},
+		{name: "sar aircraft", mmsi: 111244123, want: "NL", wantOk: true},
+		{name: "craft associated with a parent ship", mmsi: 982111234, want: "DE", wantOk: true},
+		{name: "aid to navigation", mmsi: 993661234, want: "US", wantOk: true},
+		{name: "handheld", mmsi: 853812345, want: "MH", wantOk: true},
+		{name: "unallocated mid", mmsi: 100123456},
+		{name: "sart", mmsi: 970123456},
+		{name: "coast station", mmsi: 2440001},
+		{name: "too short", mmsi: 24412345},
+		{name: "too long", mmsi: 2441234567},
+		{name: "zero", mmsi: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := flagState(tt.mmsi)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("flagState(%d) = %q %v, want %q %v", tt.mmsi, got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestShipFilterSpeed(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter ShipFilter
+		sog    float64
+		want   bool
+	}{
+		{name: "no speed filter", filter: ShipFilter{}, sog: SOG_NOT_AVAILABLE, want: true},
+		{name: "not available with min speed", filter: ShipFilter{MinSOG: 1}, sog: SOG_NOT_AVAILABLE},
+		{name: "not available with max speed", filter: ShipFilter{MaxSOG: 200}, sog: SOG_NOT_AVAILABLE},
+		{name: "stopped with max speed", filter: ShipFilter{MaxSOG: 5}, sog: 0, want: true},
+		{name: "below min speed", filter: ShipFilter{MinSOG: 5}, sog: 4.9},
+		{name: "at min speed", filter: ShipFilter{MinSOG: 5}, sog: 5, want: true},
+		{name: "at max speed", filter: ShipFilter{MaxSOG: 5}, sog: 5, want: true},
+		{name: "above max speed", filter: ShipFilter{MaxSOG: 5}, sog: 5.1},
+		{name: "within range", filter: ShipFilter{MinSOG: 5, MaxSOG: 15}, sog: 12, want: true},
+		{name: "fastest reportable", filter: ShipFilter{MinSOG: 100}, sog: 102.2, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.filter.Match(State{MMSI: 244123456, SOG: tt.sog}, 0)
+			if got != tt.want {
+				t.Errorf("Match(sog %v) with min %v max %v = %v, want %v", tt.sog, tt.filter.MinSOG, tt.filter.MaxSOG, got, tt.want)
+			}
+		})
+	}
+}
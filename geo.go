@@ -0,0 +1,153 @@
+package main
+
+import "math"
+
+const (
+	EARTH_RADIUS_NM = 3440.065
+	METERS_IN_NM    = 1852.0
+)
+
+// distanceNm returns the great-circle distance in nautical miles between two lat, lon coordinates using the haversine formula.
+func distanceNm(a []float64, b []float64) float64 {
+	lat1 := radians(a[0])
+	lat2 := radians(b[0])
+	dLat := lat2 - lat1
+	dLon := radians(b[1] - a[1])
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * EARTH_RADIUS_NM * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// bearing returns the initial great-circle bearing in degrees [0, 360) from a to b.
+func bearing(a []float64, b []float64) float64 {
+	lat1 := radians(a[0])
+	lat2 := radians(b[0])
+	dLon := radians(b[1] - a[1])
+
+	y := math.Sin(dLon) * math.Cos(lat2)
+	x := math.Cos(lat1)*math.Sin(lat2) - math.Sin(lat1)*math.Cos(lat2)*math.Cos(dLon)
+	return math.Mod(degrees(math.Atan2(y, x))+360, 360)
+}
+
+// angleDiff returns the smallest absolute difference in degrees between two bearings.
+func angleDiff(a float64, b float64) float64 {
+	d := math.Abs(math.Mod(a-b, 360))
+	if d > 180 {
+		d = 360 - d
+	}
+	return d
+}
+
+func radians(d float64) float64 {
+	return d * math.Pi / 180
+}
+
+func degrees(r float64) float64 {
+	return r * 180 / math.Pi
+}
+
+// destination returns the lat, lon reached by travelling distNm along an initial bearing in degrees from latLon.
+func destination(latLon []float64, bearingDeg float64, distNm float64) []float64 {
+	lat1 := radians(latLon[0])
+	lon1 := radians(latLon[1])
+	brng := radians(bearingDeg)
+	d := distNm / EARTH_RADIUS_NM
+
+	lat2 := math.Asin(math.Sin(lat1)*math.Cos(d) + math.Cos(lat1)*math.Sin(d)*math.Cos(brng))
+	lon2 := lon1 + math.Atan2(math.Sin(brng)*math.Sin(d)*math.Cos(lat1), math.Cos(d)-math.Sin(lat1)*math.Sin(lat2))
+
+	// Normalize longitude to [-180, 180).
+	lon := math.Mod(degrees(lon2)+540, 360) - 180
+	return []float64{degrees(lat2), lon}
+}
+
+// pointInPolygon reports whether latLon lies inside polygon, a ring of lat, lon vertices, using ray casting.
+// The ring may be open or closed. Edges run the short way round, so rings may cross the antimeridian.
+func pointInPolygon(latLon []float64, polygon [][]float64) bool {
+	ring := unwrapPolygon(polygon)
+	if len(ring) == 0 {
+		return false
+	}
+
+	// Shift the point by whole turns into the unwrapped longitudes of the ring.
+	west := ring[0][1]
+	for _, p := range ring {
+		west = min(west, p[1])
+	}
+	lon := west + math.Mod(math.Mod(latLon[1]-west, 360)+360, 360)
+
+	inside := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		a := ring[i]
+		b := ring[j]
+		if (a[0] > latLon[0]) != (b[0] > latLon[0]) && lon < (b[1]-a[1])*(latLon[0]-a[0])/(b[0]-a[0])+a[1] {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// polygonBbox returns the south west and north east corners bounding polygon.
+// The bbox wraps the antimeridian when the polygon crosses it.
+func polygonBbox(polygon [][]float64) [2][2]float64 {
+	bbox := [2][2]float64{{LATMAX, math.Inf(1)}, {LATMIN, math.Inf(-1)}}
+	for _, p := range unwrapPolygon(polygon) {
+		bbox[0][0] = min(bbox[0][0], p[0])
+		bbox[0][1] = min(bbox[0][1], p[1])
+		bbox[1][0] = max(bbox[1][0], p[0])
+		bbox[1][1] = max(bbox[1][1], p[1])
+	}
+
+	if len(polygon) == 0 || bbox[1][1]-bbox[0][1] >= 360 {
+		bbox[0][1] = LNGMIN
+		bbox[1][1] = LNGMAX
+		return bbox
+	}
+
+	bbox[0][1] = wrapLon(bbox[0][1])
+	east := wrapLon(bbox[1][1])
+	if east == LNGMIN {
+		east = LNGMAX
+	}
+	bbox[1][1] = east
+
+	return bbox
+}
+
+// unwrapPolygon returns a copy of polygon with each longitude moved by whole turns to within 180 degrees of the previous vertex,
+// so edges crossing the antimeridian are continuous. Longitudes of the copy may fall outside LNGMIN and LNGMAX.
+func unwrapPolygon(polygon [][]float64) [][]float64 {
+	ring := make([][]float64, 0, len(polygon))
+	for i, p := range polygon {
+		lon := p[1]
+		if i > 0 {
+			prev := ring[i-1][1]
+			lon = prev + wrapLon(p[1]-prev)
+		}
+		ring = append(ring, []float64{p[0], lon})
+	}
+	return ring
+}
+
+// wrapLon returns lon moved by whole turns into [LNGMIN, LNGMAX).
+func wrapLon(lon float64) float64 {
+	return math.Mod(math.Mod(lon+180, 360)+360, 360) - 180
+}
+
+// bboxPolygon returns the ring of lat, lon vertices outlining bbox.
+// Polygon edges run the short way round, so the south and north edges are split into thirds to outline bboxes wider than 180 degrees.
+func bboxPolygon(bbox [2][2]float64) [][]float64 {
+	width := bbox[1][1] - bbox[0][1]
+	if wrapsAntimeridian(bbox) {
+		width += 360
+	}
+
+	ring := [][]float64{}
+	for i := 0; i <= 3; i++ {
+		ring = append(ring, []float64{bbox[0][0], bbox[0][1] + width*float64(i)/3})
+	}
+	for i := 3; i >= 0; i-- {
+		ring = append(ring, []float64{bbox[1][0], bbox[0][1] + width*float64(i)/3})
+	}
+	return ring
+}
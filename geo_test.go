@@ -0,0 +1,104 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+// fiji is a ring around Fiji, crossing the antimeridian.
+var fiji = [][]float64{{-15, 176}, {-15, -178}, {-20, -178}, {-20, 176}}
+
+func TestPointInPolygon(t *testing.T) {
+	northSea := [][]float64{{51, 2}, {51, 5}, {54, 5}, {54, 2}, {51, 2}}
+
+	tests := []struct {
+		name    string
+		latLon  []float64
+		polygon [][]float64
+		want    bool
+	}{
+		{name: "inside", latLon: []float64{52, 3}, polygon: northSea, want: true},
+		{name: "outside", latLon: []float64{50, 3}, polygon: northSea, want: false},
+		{name: "west of the antimeridian", latLon: []float64{-17.7, 178.4}, polygon: fiji, want: true},
+		{name: "east of the antimeridian", latLon: []float64{-16.8, -179.9}, polygon: fiji, want: true},
+		{name: "opposite side of the globe", latLon: []float64{-17.7, 0}, polygon: fiji, want: false},
+		{name: "beyond the ring", latLon: []float64{-17.7, -170}, polygon: fiji, want: false},
+		{name: "whole world bbox", latLon: []float64{10, 100}, polygon: bboxPolygon([2][2]float64{{LATMIN, LNGMIN}, {LATMAX, LNGMAX}}), want: true},
+		{name: "wrapping bbox", latLon: []float64{55, -179}, polygon: bboxPolygon([2][2]float64{{50, 170}, {60, -170}}), want: true},
+		{name: "outside wrapping bbox", latLon: []float64{55, 0}, polygon: bboxPolygon([2][2]float64{{50, 170}, {60, -170}}), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pointInPolygon(tt.latLon, tt.polygon); got != tt.want {
+				t.Errorf("pointInPolygon(%v) = %v, want %v", tt.latLon, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolygonBbox(t *testing.T) {
+	tests := []struct {
+		name    string
+		polygon [][]float64
+		want    [2][2]float64
+	}{
+		{
+			name:    "inside",
+			polygon: [][]float64{{51, 2}, {51, 5}, {54, 5}, {54, 2}},
+			want:    [2][2]float64{{51, 2}, {54, 5}},
+		},
+		{
+			name:    "crossing the antimeridian",
+			polygon: fiji,
+			want:    [2][2]float64{{-20, 176}, {-15, -178}},
+		},
+		{
+			name:    "east edge on the antimeridian",
+			polygon: [][]float64{{0, 170}, {0, 180}, {10, 180}, {10, 170}},
+			want:    [2][2]float64{{0, 170}, {10, LNGMAX}},
+		},
+		{
+			name:    "whole world bbox",
+			polygon: bboxPolygon([2][2]float64{{LATMIN, LNGMIN}, {LATMAX, LNGMAX}}),
+			want:    [2][2]float64{{LATMIN, LNGMIN}, {LATMAX, LNGMAX}},
+		},
+		{
+			name:    "wrapping bbox",
+			polygon: bboxPolygon([2][2]float64{{50, 170}, {60, -170}}),
+			want:    [2][2]float64{{50, 170}, {60, -170}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := polygonBbox(tt.polygon); got != tt.want {
+				t.Errorf("polygonBbox(%v) = %v, want %v", tt.polygon, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetShipsInPolygonAntimeridian(t *testing.T) {
+	s := newTestShips(map[int][]float64{
+		1: {-17.7, 178.4},  // Suva, west of the antimeridian
+		2: {-16.8, -179.9}, // Taveuni, east of the antimeridian
+		3: {-17.7, 0},      // Gulf of Guinea
+		4: {51.9, 4.1},     // Rotterdam
+	})
+
+	ships, err := s.GetShipsInPolygon(fiji)
+	if err != nil {
+		t.Fatalf("GetShipsInPolygon failed: %s", err.Error())
+	}
+
+	got := []int{}
+	for _, ship := range ships {
+		got = append(got, ship.MMSI)
+	}
+	slices.Sort(got)
+
+	if want := []int{1, 2}; !slices.Equal(got, want) {
+		t.Errorf("GetShipsInPolygon(fiji) = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+// HistoryLimits bounds the route history kept in memory for each ship.
+// Groups overrides Default for ships in a ship group, keyed by the group ids in ShipTypeGroups.
+type HistoryLimits struct {
+	Default HistoryLimit         `json:"default"`
+	Groups  map[int]HistoryLimit `json:"groups"`
+}
+
+// HistoryLimit keeps the newest Recent points at full resolution.
+// Points older than those are thinned to one every ThinSeconds and at most Thinned of them are kept.
+type HistoryLimit struct {
+	Recent      int   `json:"recent"`
+	Thinned     int   `json:"thinned"`
+	ThinSeconds int64 `json:"thinSeconds"`
+}
+
+// HistoryBuffer is a bounded route history made of two ring buffers, recent points at full resolution followed by older thinned points.
+// Adding a point never copies the history, the oldest recent point moves to the thinned buffer or is dropped.
+type HistoryBuffer struct {
+	Limit   HistoryLimit
+	recent  historyRing
+	thinned historyRing
+}
+
+// historyRing is a fixed capacity ring of points, head is the index of the newest point.
+type historyRing struct {
+	points []History
+	head   int
+	size   int
+}
+
+func NewHistoryLimitsDefaults() HistoryLimits {
+	return HistoryLimits{
+		Default: HistoryLimit{
+			Recent:      1000,
+			Thinned:     2000,
+			ThinSeconds: 300,
+		},
+		Groups: map[int]HistoryLimit{
+			6: {Recent: 250, Thinned: 500, ThinSeconds: 600}, // Pleasure Craft
+		},
+	}
+}
+
+// For returns the limit for a ship type, falling back to Default for unknown types and groups without a limit.
+func (hl HistoryLimits) For(shipType int) HistoryLimit {
+	if class, ok := ShipTypes[shipType]; ok {
+		if limit, ok := hl.Groups[class.GroupId]; ok {
+			return limit
+		}
+	}
+	return hl.Default
+}
+
+func NewHistoryBuffer(limit HistoryLimit) *HistoryBuffer {
+	limit = limit.clamp()
+
+	return &HistoryBuffer{
+		Limit:   limit,
+		recent:  newHistoryRing(limit.Recent),
+		thinned: newHistoryRing(limit.Thinned),
+	}
+}
+
+// NewHistoryBufferFrom returns a buffer holding history, ordered newest first, that is resized to the ship's limit on the next Add.
+func NewHistoryBufferFrom(history []History) *HistoryBuffer {
+	b := NewHistoryBuffer(HistoryLimit{Recent: len(history)})
+	for i := len(history) - 1; i >= 0; i-- {
+		b.Add(history[i])
+	}
+	return b
+}
+
+// Add records h as the newest point.
+func (b *HistoryBuffer) Add(h History) {
+	evicted, ok := b.recent.push(h)
+	if !ok {
+		return
+	}
+
+	newest, ok := b.thinned.newest()
+	if !ok || evicted.Timestamp-newest.Timestamp >= b.Limit.ThinSeconds {
+		b.thinned.push(evicted)
+	}
+}
+
+// AddWithLimit records h as the newest point, first resizing the buffer if the ship's limit has changed, such as once its type is known.
+func (b *HistoryBuffer) AddWithLimit(h History, limit HistoryLimit) {
+	// Compare the clamped limit, otherwise a limit below the minimum would resize on every point.
+	if limit.clamp() != b.Limit {
+		b.resize(limit)
+	}
+	b.Add(h)
+}
+
+// clamp keeps at least one recent point, so the newest position is always known.
+func (l HistoryLimit) clamp() HistoryLimit {
+	l.Recent = max(l.Recent, 1)
+	l.Thinned = max(l.Thinned, 0)
+	return l
+}
+
+func (b *HistoryBuffer) resize(limit HistoryLimit) {
+	points := b.Points()
+	*b = *NewHistoryBuffer(limit)
+	for i := len(points) - 1; i >= 0; i-- {
+		b.Add(points[i])
+	}
+}
+
+// Latest returns the newest point.
+func (b *HistoryBuffer) Latest() (History, bool) {
+	return b.recent.newest()
+}
+
+func (b *HistoryBuffer) Len() int {
+	return b.recent.size + b.thinned.size
+}
+
+// Points returns a copy of the history ordered newest first.
+func (b *HistoryBuffer) Points() []History {
+	points := make([]History, 0, b.Len())
+	for i := 0; i < b.recent.size; i++ {
+		points = append(points, b.recent.at(i))
+	}
+	for i := 0; i < b.thinned.size; i++ {
+		points = append(points, b.thinned.at(i))
+	}
+	return points
+}
+
+// Expire removes points older than cutoff.
+func (b *HistoryBuffer) Expire(cutoff int64) {
+	b.thinned.expire(cutoff)
+	b.recent.expire(cutoff)
+}
+
+func newHistoryRing(capacity int) historyRing {
+	return historyRing{
+		points: make([]History, capacity),
+		head:   -1,
+	}
+}
+
+// push adds h as the newest point, returning the oldest point if it was overwritten.
+func (r *historyRing) push(h History) (History, bool) {
+	if len(r.points) == 0 {
+		return h, true
+	}
+
+	r.head = (r.head + 1) % len(r.points)
+	evicted := r.points[r.head]
+	r.points[r.head] = h
+
+	if r.size == len(r.points) {
+		return evicted, true
+	}
+	r.size++
+
+	return History{}, false
+}
+
+// at returns the ith newest point.
+func (r *historyRing) at(i int) History {
+	return r.points[(r.head-i+len(r.points))%len(r.points)]
+}
+
+func (r *historyRing) newest() (History, bool) {
+	if r.size == 0 {
+		return History{}, false
+	}
+	return r.at(0), true
+}
+
+// expire drops the oldest points until the oldest remaining is no older than cutoff.
+func (r *historyRing) expire(cutoff int64) {
+	for r.size > 0 && r.at(r.size-1).Timestamp < cutoff {
+		r.points[(r.head-r.size+1+len(r.points))%len(r.points)] = History{}
+		r.size--
+	}
+}
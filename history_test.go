@@ -0,0 +1,128 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+// testHistoryBuffer adds a point every minute from 0 to last seconds, oldest first.
+func testHistoryBuffer(limit HistoryLimit, last int64) *HistoryBuffer {
+	b := NewHistoryBuffer(limit)
+	for ts := int64(0); ts <= last; ts += 60 {
+		b.Add(NewHistory([]float64{50, float64(ts) / 3600}, ts))
+	}
+	return b
+}
+
+func TestHistoryBufferAdd(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit HistoryLimit
+		last  int64
+		want  []int64
+	}{
+		{name: "within recent", limit: HistoryLimit{Recent: 3, Thinned: 2, ThinSeconds: 120}, last: 120, want: []int64{120, 60, 0}},
+		// Evicted recent points are thinned to one every two minutes, the oldest thinned points are then dropped.
+		{name: "thinned", limit: HistoryLimit{Recent: 3, Thinned: 2, ThinSeconds: 120}, last: 300, want: []int64{300, 240, 180, 120, 0}},
+		{name: "thinned full", limit: HistoryLimit{Recent: 3, Thinned: 2, ThinSeconds: 120}, last: 600, want: []int64{600, 540, 480, 360, 240}},
+		{name: "no thinning", limit: HistoryLimit{Recent: 3, Thinned: 4}, last: 600, want: []int64{600, 540, 480, 420, 360, 300, 240}},
+		{name: "recent only", limit: HistoryLimit{Recent: 3}, last: 600, want: []int64{600, 540, 480}},
+		{name: "minimum recent", limit: HistoryLimit{}, last: 600, want: []int64{600}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := testHistoryBuffer(tt.limit, tt.last)
+
+			got := trackTimestamps(b.Points())
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Points() = %v, want %v", got, tt.want)
+			}
+
+			if b.Len() != len(tt.want) {
+				t.Errorf("Len() = %d, want %d", b.Len(), len(tt.want))
+			}
+
+			latest, ok := b.Latest()
+			if !ok || latest.Timestamp != tt.last {
+				t.Errorf("Latest() = %v %v, want %d", latest.Timestamp, ok, tt.last)
+			}
+		})
+	}
+}
+
+func TestHistoryBufferExpire(t *testing.T) {
+	limit := HistoryLimit{Recent: 3, Thinned: 2, ThinSeconds: 120}
+
+	tests := []struct {
+		name     string
+		cutoff   int64
+		want     []int64
+		wantNext []int64
+	}{
+		{name: "nothing expired", cutoff: 240, want: []int64{600, 540, 480, 360, 240}, wantNext: []int64{720, 660, 600, 480, 360}},
+		{name: "thinned expired", cutoff: 241, want: []int64{600, 540, 480, 360}, wantNext: []int64{720, 660, 600, 480, 360}},
+		{name: "all thinned expired", cutoff: 480, want: []int64{600, 540, 480}, wantNext: []int64{720, 660, 600, 480}},
+		{name: "recent expired", cutoff: 541, want: []int64{600}, wantNext: []int64{720, 660, 600}},
+		{name: "all expired", cutoff: 601, want: []int64{}, wantNext: []int64{720, 660}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := testHistoryBuffer(limit, 600)
+			b.Expire(tt.cutoff)
+
+			got := trackTimestamps(b.Points())
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Expire(%d) = %v, want %v", tt.cutoff, got, tt.want)
+			}
+
+			_, ok := b.Latest()
+			if ok != (len(tt.want) > 0) {
+				t.Errorf("Expire(%d) Latest() ok = %v, want %v", tt.cutoff, ok, len(tt.want) > 0)
+			}
+
+			// The rings keep working after points are expired from the middle of them.
+			b.Add(NewHistory([]float64{50, 1}, 660))
+			b.Add(NewHistory([]float64{50, 1}, 720))
+
+			got = trackTimestamps(b.Points())
+			if !slices.Equal(got, tt.wantNext) {
+				t.Errorf("Expire(%d) then Add = %v, want %v", tt.cutoff, got, tt.wantNext)
+			}
+		})
+	}
+}
+
+func TestHistoryBufferResize(t *testing.T) {
+	initial := HistoryLimit{Recent: 3, Thinned: 2, ThinSeconds: 120}
+	next := NewHistory([]float64{50, 1}, 660)
+
+	tests := []struct {
+		name  string
+		limit HistoryLimit
+		want  []int64
+	}{
+		{name: "unchanged", limit: initial, want: []int64{660, 600, 540, 480, 360}},
+		{name: "grow", limit: HistoryLimit{Recent: 5, Thinned: 2, ThinSeconds: 120}, want: []int64{660, 600, 540, 480, 360, 240}},
+		{name: "shrink", limit: HistoryLimit{Recent: 2, Thinned: 1, ThinSeconds: 120}, want: []int64{660, 600, 480}},
+		{name: "thin more", limit: HistoryLimit{Recent: 3, Thinned: 2, ThinSeconds: 600}, want: []int64{660, 600, 540, 240}},
+		{name: "below minimum", limit: HistoryLimit{}, want: []int64{660}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := testHistoryBuffer(initial, 600)
+			b.AddWithLimit(next, tt.limit)
+
+			got := trackTimestamps(b.Points())
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("AddWithLimit(%+v) = %v, want %v", tt.limit, got, tt.want)
+			}
+
+			if b.Limit != tt.limit.clamp() {
+				t.Errorf("AddWithLimit(%+v) Limit = %+v, want %+v", tt.limit, b.Limit, tt.limit.clamp())
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ import { getTileBounds, fromLatLngToTilePixel } from './mercator.js';
 await google.maps.importLibrary("maps");
 
 const tileSize = 256;
+const liveRetryMs = 5000;
 const axiosInstance = axios.create({
     baseURL: window.location.origin,
     timeout: 1000,
@@ -76,7 +77,7 @@ class SeaSpyMapType {
 
         this.state.shapes.set(tileId, []);
 
-        this.state.tileIdToDetails.set(tileId, { bounds: bounds, coord: coord, canvas: canvas, zoom: zoom, size: tileSize });
+        this.state.tileIdToDetails.set(tileId, { bounds: bounds, coord: coord, canvas: canvas, zoom: zoom, size: tileSize, ships: { version: null, byMmsi: new Map() } });
         this.state.overlays.set(tileId, canvasOverlay);
 
         this.state.active.set(tileId, 0);
@@ -126,6 +127,7 @@ async function seaspy() {
         navstatus: shipmetaData.navStatus,
         infowindow: infoWindow,
         route: polyline,
+        prediction: new google.maps.Polyline,
         search: [],
     };
 
@@ -145,17 +147,26 @@ async function seaspy() {
         searchHandler(e.target.value, gmap, shipmeta)
     }, 500));
 
+    const live = connectLive(gmap, state, shipmeta);
+
+    // Tiles are redrawn as live updates arrive, polling is only needed while the live socket is down.
     setInterval(async function(){
-        drawTiles(state, shipmeta);
+        if (!live.ready) {
+            drawTiles(state, shipmeta, live);
+        }
         shipmeta.search = await getSearchCache();
     }, 10000);
 
+    google.maps.event.addListener(gmap, 'idle', function() {
+        subscribeLive(live, gmap);
+    });
+
     google.maps.event.addListener(gmap, 'zoom_changed', function() {
         stateCleanup(state);
     });
 
     google.maps.event.addListener(gmap, 'tilesloaded', async function() {
-        drawTiles(state, shipmeta);
+        drawTiles(state, shipmeta, live);
         shipmeta.search = await getSearchCache();
     });
 }
@@ -181,11 +192,11 @@ function stateCleanup(state) {
 
 // drawTiles draws ship markers based on latlng bounding box of the tile.
 // Tiles are drawn in forward then reverse order to ensure all ship clips are drawn.
-async function drawTiles(state, shipmeta) {
+async function drawTiles(state, shipmeta, live) {
     const tileData = new Map();
     await Promise.all(
-        state.tileIdToDetails.entries().map(async ([tileId, { bounds }]) => {
-            const data = await getShipsBbox(bounds);
+        state.tileIdToDetails.entries().map(async ([tileId, { bounds, ships }]) => {
+            const data = live.ready ? getLiveShipsBbox(live, bounds) : await getShipsBbox(bounds, ships);
             tileData.set(tileId, data);
         })
     );
@@ -241,12 +252,13 @@ function searchHandler(q, gmap, shipmeta) {
 
     for (let ship of shipmeta.search) {
         let mmsiMatch = ship.mmsi == search;
+        let destMatch = ship.destination && ship.destination.toLowerCase() == search;
         let shipMatch = false;
         if (ship.name) {
             shipMatch = ship.name.trim().toLowerCase().includes(search);
         }
 
-        if (shipMatch || mmsiMatch) {
+        if (shipMatch || mmsiMatch || destMatch) {
             if (results.length >= resultLimit) {
                 break;
             }
@@ -279,6 +291,7 @@ function searchHandler(q, gmap, shipmeta) {
             gmap.setZoom(15);
             openInfoWindow(gmap, shipmeta, r.mmsi);
             openShipHistory(gmap, shipmeta, r.mmsi);
+            openShipRoute(gmap, shipmeta, r.mmsi);
         });
 
         searchResults.appendChild(resultDiv);
@@ -335,6 +348,39 @@ async function openShipHistory(gmap, shipmeta, mmsi) {
     shipmeta.route.setMap(gmap);
 }
 
+// openShipRoute draws the server's predicted route ahead of the ship next to its history track.
+async function openShipRoute(gmap, shipmeta, mmsi) {
+    const shipRoute = await getShipRoute(mmsi);
+
+    if (shipmeta.prediction) shipmeta.prediction.setMap(null);
+
+    if (shipRoute.length < 2) {
+        return;
+    }
+
+    const routeIcon = {
+        path: "M 0,-1 0,1",
+        strokeColor: "#ad0303",
+        strokeOpacity: 1,
+        scale: 1,
+    };
+
+    shipmeta.prediction = new google.maps.Polyline({
+        path: shipRoute,
+        strokeOpacity: 0,
+        strokeWeight: 0,
+        icons: [
+            {
+                icon: routeIcon,
+                "offset": 0,
+                "repeat": "10px",
+            },
+        ],
+    });
+
+    shipmeta.prediction.setMap(gmap);
+}
+
 async function addShipMarker(state, shipGroup, ship, tileId) {
     let latlng = {lat: ship.latlon[0], lng: ship.latlon[1]};
 
@@ -413,8 +459,10 @@ async function canvasClick(shapes, shipmeta, ctx, gmap, e) {
     if (mmsi) {
         openInfoWindow(gmap, shipmeta, mmsi);
         openShipHistory(gmap, shipmeta, mmsi);
+        openShipRoute(gmap, shipmeta, mmsi);
     } else {
         if (shipmeta.route) shipmeta.route.setMap(null);
+        if (shipmeta.prediction) shipmeta.prediction.setMap(null);
         if (shipmeta.infowindow) shipmeta.infowindow.close();
     }
 }
@@ -452,15 +500,46 @@ function formatContent(shipInfo) {
     `Position: ${shipInfo.latlon[0].toFixed(4)}, ${shipInfo.latlon[1].toFixed(4)}\n` +
     `Heading: ${shipInfo.heading}\n` +
     `Speed (kt): ${shipInfo.sog}\n` +
-    `Dest: ${shipInfo.destination}\n` +
+    `Dest: ${shipInfo.destination}${shipInfo.destinationLocode ? ` (${shipInfo.destinationLocode})` : ``}\n` +
     `ShipType: ${shipInfo.category} (${shipInfo.shipType})\n` +
     `Status: ${shipInfo.navDescription} (${shipInfo.navStatus})\n` +
+    formatEta(shipInfo.eta) +
     `Last Seen: ${friendlyTime(shipInfo.lastUpdate)}` +
+    (shipInfo.tags && shipInfo.tags.length > 0 ? `\nAlerts: ${shipInfo.tags.join(", ")}` : ``) +
+    formatEncounters(shipInfo.encounters) +
     `</div>`;
 
     return content;
 }
 
+// formatEta shows the reported ETA next to the ETA predicted by the server.
+function formatEta(eta) {
+    if (!eta || (!eta.reported && !eta.predicted)) {
+        return ``;
+    }
+
+    let reported = eta.reported ? friendlyDate(eta.reported) : `n/a`;
+    let predicted = eta.predicted ? friendlyDate(eta.predicted) : `n/a`;
+    return `ETA: ${reported} (predicted ${predicted})\n`;
+}
+
+function friendlyDate(timestamp) {
+    return new Date(timestamp * 1000).toISOString().slice(0, 16).replace("T", " ") + "Z";
+}
+
+// formatEncounters lists the closest approaching vessels returned with the info window.
+function formatEncounters(encounters) {
+    if (!encounters || encounters.length == 0) {
+        return ``;
+    }
+
+    let s = `\nCPA:`;
+    for (let e of encounters.slice(0, 3)) {
+        s += `\n  ${e.otherName || e.other} ${e.cpaNm.toFixed(2)}nm in ${Math.round(e.tcpaMinutes)}m`;
+    }
+    return s;
+}
+
 function friendlyTime(lastUpdate) {
     let time = Math.floor(Date.now() / 1000) - lastUpdate;
 
@@ -490,13 +569,100 @@ function friendlyTime(lastUpdate) {
 // getShipsBbox returns an array of ships, sorted by geohash.
 // Plotting shapes in this order will result shape overlap that is not aesthetically pleasing.
 // Sorting by mmsi will plot shapes in a manner that lacks geospatial awareness.
-async function getShipsBbox(bounds) {
+// Once a tile has been fetched only ships changed since the tile's version are requested and merged into its ships.
+async function getShipsBbox(bounds, ships) {
     const uri = `/ships/${bounds.sw.lat},${bounds.sw.lng}/${bounds.ne.lat},${bounds.ne.lng}`
-    const { data } = await axiosInstance.get(uri);
+
+    if (ships.version === null) {
+        const rsp = await axiosInstance.get(uri);
+        ships.version = rsp.headers['x-ships-version'];
+        ships.byMmsi = new Map(rsp.data.map((ship) => [ship.mmsi, ship]));
+    } else {
+        const { data } = await axiosInstance.get(uri, { params: { since: ships.version } });
+        if (data.full) {
+            ships.byMmsi = new Map();
+        }
+        for (let ship of data.ships) {
+            ships.byMmsi.set(ship.mmsi, ship);
+        }
+        for (let mmsi of data.removed) {
+            ships.byMmsi.delete(mmsi);
+        }
+        ships.version = data.version;
+    }
+
+    // Ships that moved out of the tile are not reported as removed.
+    for (let [mmsi, ship] of ships.byMmsi) {
+        const [lat, lng] = ship.latlon;
+        if (lat < bounds.sw.lat || lat > bounds.ne.lat || lng < bounds.sw.lng || lng > bounds.ne.lng) {
+            ships.byMmsi.delete(mmsi);
+        }
+    }
+
+    const data = Array.from(ships.byMmsi.values());
+    data.sort((a,b) => a.mmsi - b.mmsi);
+    return data;
+}
+
+// getLiveShipsBbox returns the live ships inside bounds, sorted by mmsi like getShipsBbox.
+function getLiveShipsBbox(live, bounds) {
+    const data = [];
+    for (let ship of live.ships.values()) {
+        const [lat, lng] = ship.latlon;
+        if (lat >= bounds.sw.lat && lat <= bounds.ne.lat && lng >= bounds.sw.lng && lng <= bounds.ne.lng) {
+            data.push(ship);
+        }
+    }
     data.sort((a,b) => a.mmsi - b.mmsi);
     return data;
 }
 
+// connectLive streams the ships inside the map viewport over the /live WebSocket and redraws tiles as batches arrive.
+// While the socket is closed tiles fall back to polling, and the socket is reopened after liveRetryMs.
+function connectLive(gmap, state, shipmeta, live = { ships: new Map(), socket: null, ready: false }) {
+    const scheme = window.location.protocol === "https:" ? "wss" : "ws";
+    const socket = new WebSocket(`${scheme}://${window.location.host}/live`);
+    live.socket = socket;
+
+    socket.addEventListener("open", () => {
+        subscribeLive(live, gmap);
+    });
+
+    socket.addEventListener("message", (e) => {
+        const msg = JSON.parse(e.data);
+        if (msg.type === "snapshot") {
+            live.ships = new Map();
+            live.ready = true;
+        }
+        for (let ship of msg.ships) {
+            live.ships.set(ship.mmsi, ship);
+        }
+        for (let mmsi of msg.removed) {
+            live.ships.delete(mmsi);
+        }
+        drawTiles(state, shipmeta, live);
+    });
+
+    socket.addEventListener("close", () => {
+        live.ready = false;
+        setTimeout(() => connectLive(gmap, state, shipmeta, live), liveRetryMs);
+    });
+
+    return live;
+}
+
+// subscribeLive subscribes the live socket to the current map viewport, the server replies with a snapshot of its ships.
+function subscribeLive(live, gmap) {
+    const bounds = gmap.getBounds();
+    if (!live.socket || live.socket.readyState !== WebSocket.OPEN || !bounds) {
+        return;
+    }
+
+    const sw = bounds.getSouthWest();
+    const ne = bounds.getNorthEast();
+    live.socket.send(JSON.stringify({ sw: `${sw.lat()},${sw.lng()}`, ne: `${ne.lat()},${ne.lng()}` }));
+}
+
 async function getShipInfoWindow(mmsi) {
     const { data } = await axiosInstance.get('/shipInfoWindow/' + mmsi);
     return data;
@@ -529,6 +695,19 @@ async function getShipHistory(mmsi) {
     return hist;
 }
 
+async function getShipRoute(mmsi) {
+    const { data } = await axiosInstance.get('/shipRoute/' + mmsi);
+
+    let route = [];
+    for (let n of data) {
+        route.push({
+            "lat": n.latlon[0],
+            "lng": n.latlon[1]
+        });
+    }
+    return route;
+}
+
 async function getSearchCache() {
     const { data } = await axiosInstance.get('/searchFields');
     return data;
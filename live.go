@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"nhooyr.io/websocket"
+	"nhooyr.io/websocket/wsjson"
+)
+
+const (
+	LIVE_FEED_SIZE             = 65536
+	LIVE_BATCH_MS              = 1000
+	LIVE_WRITE_TIMEOUT_SECONDS = 10
+)
+
+// LiveFeed is a ring of the mmsis updated by the dock workers, read by live clients from their own cursor.
+// A client whose cursor has been overwritten has fallen behind and resends its whole viewport.
+type LiveFeed struct {
+	Lock    sync.Mutex
+	updates []int
+	next    uint64
+}
+
+// LiveClient pushes the ships inside a subscribed viewport to a browser over a WebSocket.
+// Updates are batched every LIVE_BATCH_MS, ships that leave the viewport, stop matching the filter or are removed are sent as removed.
+type LiveClient struct {
+	Conn   *websocket.Conn
+	Dock   *Dock
+	bbox   [2][2]float64
+	filter ShipFilter
+	cursor uint64
+	sent   map[int]bool
+}
+
+// LiveRequest subscribes a client to a viewport, replacing any previous subscription.
+// SW and NE are lat,lon pairs as in /ships/{sw}/{ne} and Filter takes the query parameters of that endpoint, such as group=0,5&named=true.
+type LiveRequest struct {
+	SW     string `json:"sw"`
+	NE     string `json:"ne"`
+	Filter string `json:"filter"`
+}
+
+// LiveMessage is sent to live clients. A snapshot replaces the client's ships, an update changes them.
+type LiveMessage struct {
+	Type    string           `json:"type"`
+	Ships   []EstimatedState `json:"ships"`
+	Removed []int            `json:"removed"`
+}
+
+func NewLiveFeed() *LiveFeed {
+	return &LiveFeed{
+		updates: make([]int, LIVE_FEED_SIZE),
+	}
+}
+
+// Publish records an update to mmsi.
+func (f *LiveFeed) Publish(mmsi int) {
+	f.Lock.Lock()
+	f.updates[f.next%LIVE_FEED_SIZE] = mmsi
+	f.next++
+	f.Lock.Unlock()
+}
+
+func (f *LiveFeed) Cursor() uint64 {
+	f.Lock.Lock()
+	defer f.Lock.Unlock()
+
+	return f.next
+}
+
+// Since returns the distinct mmsis published after cursor and the cursor to read from next.
+// Returns false if updates after cursor have already been overwritten.
+func (f *LiveFeed) Since(cursor uint64) ([]int, uint64, bool) {
+	f.Lock.Lock()
+	defer f.Lock.Unlock()
+
+	if f.next-cursor > LIVE_FEED_SIZE {
+		return nil, f.next, false
+	}
+
+	seen := map[int]bool{}
+	mmsis := []int{}
+	for i := cursor; i < f.next; i++ {
+		mmsi := f.updates[i%LIVE_FEED_SIZE]
+		if !seen[mmsi] {
+			seen[mmsi] = true
+			mmsis = append(mmsis, mmsi)
+		}
+	}
+
+	return mmsis, f.next, true
+}
+
+func NewLiveClient(conn *websocket.Conn, d *Dock) *LiveClient {
+	return &LiveClient{
+		Conn: conn,
+		Dock: d,
+		sent: map[int]bool{},
+	}
+}
+
+// Run reads subscriptions and pushes updates until the connection closes or ctx is done.
+func (c *LiveClient) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	requests := make(chan LiveRequest, 1)
+	readErr := make(chan error, 1)
+
+	go func() {
+		for {
+			var req LiveRequest
+			err := wsjson.Read(ctx, c.Conn, &req)
+			if err != nil {
+				readErr <- err
+				return
+			}
+
+			select {
+			case requests <- req:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	subscribed := false
+	ticker := time.NewTicker(LIVE_BATCH_MS * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-readErr:
+			return err
+		case req := <-requests:
+			err := c.subscribe(req)
+			if err != nil {
+				c.Conn.Close(websocket.StatusUnsupportedData, err.Error())
+				return err
+			}
+			subscribed = true
+
+			err = c.snapshot(ctx)
+			if err != nil {
+				return err
+			}
+		case <-ticker.C:
+			if !subscribed {
+				continue
+			}
+
+			err := c.update(ctx)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (c *LiveClient) subscribe(req LiveRequest) error {
+	sw := strings.Split(req.SW, ",")
+	ne := strings.Split(req.NE, ",")
+	if len(sw) != 2 || len(ne) != 2 {
+		return fmt.Errorf("subscription requires sw and ne as lat,lon")
+	}
+
+	bbox, err := generateBbox(sw, ne)
+	if err != nil {
+		return fmt.Errorf("could not parse subscription bbox: %w", err)
+	}
+
+	if !validBbox(bbox) {
+		return fmt.Errorf("bounding box out of range")
+	}
+
+	q, err := url.ParseQuery(req.Filter)
+	if err != nil {
+		return fmt.Errorf("could not parse subscription filter: %w", err)
+	}
+
+	filter, err := shipFilter(q)
+	if err != nil {
+		return err
+	}
+
+	c.bbox = bbox
+	c.filter = filter
+
+	return nil
+}
+
+// snapshot sends every ship in the viewport. The cursor is read first so updates made while the snapshot is built are sent again.
+func (c *LiveClient) snapshot(ctx context.Context) error {
+	c.cursor = c.Dock.Live.Cursor()
+
+	ships, err := c.Dock.Ships.GetShipsInBox(c.bbox)
+	if err != nil {
+		return err
+	}
+	ships = c.Dock.Ships.FilterShips(ships, c.filter)
+
+	c.sent = map[int]bool{}
+	for _, ship := range ships {
+		c.sent[ship.MMSI] = true
+	}
+
+	return c.write(ctx, LiveMessage{
+		Type:    "snapshot",
+		Ships:   c.Dock.Ships.DeadReckon(ships, c.Dock.DeadReckoning),
+		Removed: []int{},
+	})
+}
+
+// update sends the ships updated since the last batch, nothing is sent when no ship in the viewport changed.
+func (c *LiveClient) update(ctx context.Context) error {
+	mmsis, cursor, ok := c.Dock.Live.Since(c.cursor)
+	if !ok {
+		return c.snapshot(ctx)
+	}
+	c.cursor = cursor
+
+	ships := make([]*State, 0)
+	removed := make([]int, 0)
+	now := time.Now().Unix()
+
+	c.Dock.Ships.StateLock.RLock()
+	for _, mmsi := range mmsis {
+		ship, ok := c.Dock.Ships.State[mmsi]
+		if ok && inBbox(ship.LatLon, c.bbox) && c.filter.Match(*ship, now) {
+			ships = append(ships, ship)
+			c.sent[mmsi] = true
+		} else if c.sent[mmsi] {
+			removed = append(removed, mmsi)
+			delete(c.sent, mmsi)
+		}
+	}
+	c.Dock.Ships.StateLock.RUnlock()
+
+	if len(ships) == 0 && len(removed) == 0 {
+		return nil
+	}
+
+	return c.write(ctx, LiveMessage{
+		Type:    "update",
+		Ships:   c.Dock.Ships.DeadReckon(ships, c.Dock.DeadReckoning),
+		Removed: removed,
+	})
+}
+
+func (c *LiveClient) write(ctx context.Context, msg LiveMessage) error {
+	ctx, cancel := context.WithTimeout(ctx, LIVE_WRITE_TIMEOUT_SECONDS*time.Second)
+	defer cancel()
+
+	err := wsjson.Write(ctx, c.Conn, msg)
+	if err != nil {
+		return fmt.Errorf("could not write live message: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"nhooyr.io/websocket"
+	"nhooyr.io/websocket/wsjson"
+)
+
+func TestLiveFeedSince(t *testing.T) {
+	tests := []struct {
+		name       string
+		publish    int
+		cursor     uint64
+		want       []int
+		wantCursor uint64
+		wantOk     bool
+	}{
+		{name: "nothing published", publish: 0, cursor: 0, want: []int{}, wantCursor: 0, wantOk: true},
+		{name: "distinct in order", publish: 10, cursor: 4, want: []int{4, 0, 1, 2, 3}, wantCursor: 10, wantOk: true},
+		{name: "whole feed", publish: LIVE_FEED_SIZE, cursor: 0, want: []int{0, 1, 2, 3, 4}, wantCursor: LIVE_FEED_SIZE, wantOk: true},
+		{name: "oldest kept update", publish: LIVE_FEED_SIZE + 5, cursor: 5, want: []int{0, 1, 2, 3, 4}, wantCursor: LIVE_FEED_SIZE + 5, wantOk: true},
+		{name: "overrun", publish: LIVE_FEED_SIZE + 5, cursor: 4, wantCursor: LIVE_FEED_SIZE + 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := NewLiveFeed()
+			for i := range tt.publish {
+				f.Publish(i % 5)
+			}
+
+			got, cursor, ok := f.Since(tt.cursor)
+			if ok != tt.wantOk || cursor != tt.wantCursor {
+				t.Fatalf("Since(%d) = cursor %d %v, want cursor %d %v", tt.cursor, cursor, ok, tt.wantCursor, tt.wantOk)
+			}
+			if ok && !slices.Equal(got, tt.want) {
+				t.Errorf("Since(%d) = %v, want %v", tt.cursor, got, tt.want)
+			}
+		})
+	}
+}
+
+// liveMMSIs returns the sorted mmsis of the ships in msg.
+func liveMMSIs(msg LiveMessage) []int {
+	mmsis := []int{}
+	for _, ship := range msg.Ships {
+		mmsis = append(mmsis, ship.MMSI)
+	}
+	slices.Sort(mmsis)
+	return mmsis
+}
+
+func TestLiveClientUpdate(t *testing.T) {
+	d := &Dock{
+		Ships: newTestShips(map[int][]float64{1: {51.9, 4.1}, 2: {51.8, 4.2}, 3: {53.0, 4.1}}),
+		Live:  NewLiveFeed(),
+	}
+
+	clients := make(chan *LiveClient)
+	done := make(chan struct{})
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			t.Errorf("could not accept websocket: %s", err.Error())
+			return
+		}
+		defer conn.CloseNow()
+
+		clients <- NewLiveClient(conn, d)
+		<-done
+	}))
+	defer srv.Close()
+	defer close(done)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	conn, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("could not dial websocket: %s", err.Error())
+	}
+	defer conn.CloseNow()
+
+	c := <-clients
+
+	read := func() LiveMessage {
+		t.Helper()
+
+		var msg LiveMessage
+		err := wsjson.Read(ctx, conn, &msg)
+		if err != nil {
+			t.Fatalf("could not read live message: %s", err.Error())
+		}
+		return msg
+	}
+
+	err = c.subscribe(LiveRequest{SW: "51.5,3.9", NE: "52.0,4.3"})
+	if err != nil {
+		t.Fatalf("subscribe failed: %s", err.Error())
+	}
+
+	err = c.snapshot(ctx)
+	if err != nil {
+		t.Fatalf("snapshot failed: %s", err.Error())
+	}
+
+	msg := read()
+	if msg.Type != "snapshot" || !slices.Equal(liveMMSIs(msg), []int{1, 2}) {
+		t.Fatalf("snapshot = %s %v, want snapshot [1 2]", msg.Type, liveMMSIs(msg))
+	}
+
+	// Ship 1 moves within the viewport, ship 2 leaves it and ship 3 moves outside it without ever being sent.
+	d.Ships.StateLock.Lock()
+	d.Ships.State[1].LatLon = []float64{51.95, 4.15}
+	d.Ships.State[2].LatLon = []float64{52.5, 4.2}
+	d.Ships.State[3].LatLon = []float64{53.1, 4.1}
+	d.Ships.StateLock.Unlock()
+	d.Live.Publish(1)
+	d.Live.Publish(2)
+	d.Live.Publish(3)
+
+	err = c.update(ctx)
+	if err != nil {
+		t.Fatalf("update failed: %s", err.Error())
+	}
+
+	msg = read()
+	if msg.Type != "update" || !slices.Equal(liveMMSIs(msg), []int{1}) || !slices.Equal(msg.Removed, []int{2}) {
+		t.Fatalf("update = %s %v removed %v, want update [1] removed [2]", msg.Type, liveMMSIs(msg), msg.Removed)
+	}
+
+	// Ship 2 has already been removed, so leaving again sends nothing.
+	d.Live.Publish(2)
+	err = c.update(ctx)
+	if err != nil {
+		t.Fatalf("update failed: %s", err.Error())
+	}
+
+	// A client that falls more than LIVE_FEED_SIZE updates behind resends its whole viewport.
+	d.Ships.StateLock.Lock()
+	d.Ships.State[2].LatLon = []float64{51.8, 4.2}
+	d.Ships.StateLock.Unlock()
+	for range LIVE_FEED_SIZE + 1 {
+		d.Live.Publish(3)
+	}
+
+	err = c.update(ctx)
+	if err != nil {
+		t.Fatalf("update failed: %s", err.Error())
+	}
+
+	msg = read()
+	if msg.Type != "snapshot" || !slices.Equal(liveMMSIs(msg), []int{1, 2}) {
+		t.Fatalf("update after overrun = %s %v, want snapshot [1 2]", msg.Type, liveMMSIs(msg))
+	}
+
+	if c.cursor != d.Live.Cursor() {
+		t.Errorf("cursor after overrun = %d, want %d", c.cursor, d.Live.Cursor())
+	}
+}
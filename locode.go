@@ -0,0 +1,210 @@
+package main
+
+import (
+	"slices"
+	"strings"
+)
+
+const (
+	LOCODE_CONFIDENCE_EXACT    = 1.0
+	LOCODE_CONFIDENCE_NAME     = 0.95
+	LOCODE_CONFIDENCE_WORD     = 0.85
+	LOCODE_CONFIDENCE_LOCATION = 0.8
+	LOCODE_FUZZY_THRESHOLD     = 0.8
+	LOCODE_FUZZY_WEIGHT        = 0.9
+	LOCODE_MAX_NGRAM           = 3
+)
+
+// destinationIgnore lists destination values that do not refer to a port.
+var destinationIgnore = []string{
+	"FOR ORDERS",
+	"FOR ORDER",
+	"ORDERS",
+	"TBA",
+	"TBN",
+	"TBC",
+	"NONE",
+	"NIL",
+	"NA",
+	"N A",
+	"UNKNOWN",
+	"AT SEA",
+	"SEA",
+	"FISHING",
+	"FISHING GROUND",
+}
+
+// destinationIndex maps compacted port names and aliases, as well as UN/LOCODE location codes, to their UN/LOCODE.
+type destinationIndex struct {
+	names     map[string]string
+	locations map[string][]string
+}
+
+var portIndex = newDestinationIndex(Ports)
+
+func newDestinationIndex(ports map[string]Port) destinationIndex {
+	idx := destinationIndex{
+		names:     map[string]string{},
+		locations: map[string][]string{},
+	}
+
+	for locode, port := range ports {
+		idx.names[compactDestination(port.Name)] = locode
+		for _, alias := range port.Aliases {
+			idx.names[compactDestination(alias)] = locode
+		}
+		idx.locations[locode[2:]] = append(idx.locations[locode[2:]], locode)
+	}
+
+	return idx
+}
+
+// NormalizeDestination maps a free text AIS destination to a UN/LOCODE from the bundled port list.
+// The returned confidence is between 0 and 1, where 0 indicates no match.
+// Route style destinations such as "NLRTM>DEHAM" or "RTM>>" are resolved to their final port.
+func NormalizeDestination(dest string) (string, float64) {
+	words := destinationWords(finalDestination(dest))
+	if len(words) == 0 {
+		return "", 0
+	}
+
+	if slices.Contains(destinationIgnore, strings.Join(words, " ")) {
+		return "", 0
+	}
+
+	compact := strings.Join(words, "")
+
+	if _, ok := Ports[compact]; ok {
+		return compact, LOCODE_CONFIDENCE_EXACT
+	}
+
+	if locode, ok := portIndex.names[compact]; ok {
+		return locode, LOCODE_CONFIDENCE_NAME
+	}
+
+	if locodes := portIndex.locations[compact]; len(locodes) == 1 {
+		return locodes[0], LOCODE_CONFIDENCE_LOCATION
+	}
+
+	// Look for a LOCODE, port name or alias among the words, preferring longer phrases.
+	for n := min(LOCODE_MAX_NGRAM, len(words)); n > 0; n-- {
+		for i := 0; i+n <= len(words); i++ {
+			phrase := strings.Join(words[i:i+n], "")
+			if _, ok := Ports[phrase]; ok && n == 1 {
+				return phrase, LOCODE_CONFIDENCE_WORD
+			}
+			if locode, ok := portIndex.names[phrase]; ok && len(phrase) > 3 {
+				return locode, LOCODE_CONFIDENCE_WORD
+			}
+		}
+	}
+
+	return portIndex.fuzzy(compact)
+}
+
+// fuzzy returns the port whose name or alias is most similar to dest using levenshtein distance.
+func (idx destinationIndex) fuzzy(dest string) (string, float64) {
+	if len(dest) < 4 {
+		return "", 0
+	}
+
+	best := ""
+	bestScore := 0.0
+	for name, locode := range idx.names {
+		score := similarity(dest, name)
+		if score > bestScore || score == bestScore && locode < best {
+			best = locode
+			bestScore = score
+		}
+	}
+
+	if bestScore < LOCODE_FUZZY_THRESHOLD {
+		return "", 0
+	}
+
+	return best, bestScore * LOCODE_FUZZY_WEIGHT
+}
+
+// finalDestination returns the last non-empty segment of a route style destination.
+func finalDestination(dest string) string {
+	segments := strings.FieldsFunc(strings.ToUpper(dest), func(r rune) bool {
+		return r == '>'
+	})
+
+	for i := len(segments) - 1; i >= 0; i-- {
+		if len(destinationWords(segments[i])) > 0 {
+			return segments[i]
+		}
+	}
+
+	return ""
+}
+
+// destinationWords upper cases dest and splits it into words of letters and digits.
+func destinationWords(dest string) []string {
+	return strings.FieldsFunc(strings.ToUpper(dest), func(r rune) bool {
+		return !(r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	})
+}
+
+func compactDestination(dest string) string {
+	return strings.Join(destinationWords(dest), "")
+}
+
+// similarity returns 1 minus the levenshtein distance normalized by the longer string length.
+func similarity(a string, b string) float64 {
+	l := max(len(a), len(b))
+	if l == 0 {
+		return 1
+	}
+	return 1 - float64(levenshtein(a, b))/float64(l)
+}
+
+func levenshtein(a string, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(b)]
+}
+
+// GetShipsByDestination returns every ship whose normalized destination matches locode.
+func (s *Ships) GetShipsByDestination(locode string) []*State {
+	locode = strings.ToUpper(locode)
+
+	s.InfoLock.RLock()
+	mmsis := []int{}
+	for mmsi, info := range s.Info {
+		if info.DestinationLocode == locode {
+			mmsis = append(mmsis, mmsi)
+		}
+	}
+	s.InfoLock.RUnlock()
+
+	ships := make([]*State, 0, len(mmsis))
+
+	s.StateLock.RLock()
+	for _, mmsi := range mmsis {
+		if ship, ok := s.State[mmsi]; ok {
+			ships = append(ships, ship)
+		}
+	}
+	s.StateLock.RUnlock()
+
+	return ships
+}
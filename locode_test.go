@@ -0,0 +1,53 @@
+package main
+
+import "testing"
+
+func TestNormalizeDestination(t *testing.T) {
+	tests := []struct {
+		dest       string
+		want       string
+		confidence float64
+		fuzzy      bool
+	}{
+		{dest: "NLRTM", want: "NLRTM", confidence: LOCODE_CONFIDENCE_EXACT},
+		{dest: "NL RTM", want: "NLRTM", confidence: LOCODE_CONFIDENCE_EXACT},
+		{dest: "US NYC", want: "USNYC", confidence: LOCODE_CONFIDENCE_EXACT},
+		{dest: "ROTTERDAM", want: "NLRTM", confidence: LOCODE_CONFIDENCE_NAME},
+		{dest: "rotterdam", want: "NLRTM", confidence: LOCODE_CONFIDENCE_NAME},
+		{dest: "ANTWERPEN", want: "BEANR", confidence: LOCODE_CONFIDENCE_NAME},
+		{dest: "ROTTERDAM>ANTWERP", want: "BEANR", confidence: LOCODE_CONFIDENCE_NAME},
+		{dest: "NLRTM > DEHAM", want: "DEHAM", confidence: LOCODE_CONFIDENCE_EXACT},
+		{dest: "RTM>>", want: "NLRTM", confidence: LOCODE_CONFIDENCE_LOCATION},
+		{dest: "ANTWERP ANCH", want: "BEANR", confidence: LOCODE_CONFIDENCE_WORD},
+		{dest: "ROTTERDAM/EUROPOORT", want: "NLRTM", confidence: LOCODE_CONFIDENCE_WORD},
+		{dest: "ROTERDAM", want: "NLRTM", fuzzy: true},
+		{dest: "ROTTERDAMM", want: "NLRTM", fuzzy: true},
+		{dest: "HAMBURGH", want: "DEHAM", fuzzy: true},
+		{dest: "HAMBRG", want: "DEHAM", fuzzy: true},
+		{dest: ""},
+		{dest: "   "},
+		{dest: ">"},
+		{dest: "N/A"},
+		{dest: "N.A."},
+		{dest: "FOR ORDERS"},
+		{dest: "PILOT STATION"},
+		{dest: "XXYYZZ"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dest, func(t *testing.T) {
+			got, confidence := NormalizeDestination(tt.dest)
+			if got != tt.want {
+				t.Errorf("NormalizeDestination(%q) = %q, want %q", tt.dest, got, tt.want)
+			}
+
+			if tt.fuzzy {
+				if confidence < LOCODE_FUZZY_THRESHOLD*LOCODE_FUZZY_WEIGHT || confidence >= LOCODE_FUZZY_WEIGHT {
+					t.Errorf("NormalizeDestination(%q) confidence = %v, want a fuzzy match", tt.dest, confidence)
+				}
+			} else if confidence != tt.confidence {
+				t.Errorf("NormalizeDestination(%q) confidence = %v, want %v", tt.dest, confidence, tt.confidence)
+			}
+		})
+	}
+}
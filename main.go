@@ -17,6 +17,7 @@ type Config struct {
 	Dock      Dock             `json:"dock"`
 	Portal    Portal           `json:"portal"`
 	Swabby    Swabby           `json:"swabby"`
+	Behaviour Behaviour        `json:"behaviour"`
 	Aisstream aisstream.Config `json:"aisstream"`
 	Google    Google           `json:"google"`
 }
@@ -42,6 +43,9 @@ func main() {
 	swabby := NewSwabby(config.Swabby)
 	go swabby.Cleanup(dock)
 
+	behaviour := NewBehaviour(config.Behaviour)
+	go behaviour.Detect(dock)
+
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer cancel()
 	ListenAndServe(ctx, dock, config.Portal, config.Google)
@@ -54,6 +58,9 @@ func main() {
 
 	swabby.Quit <- struct{}{}
 	<-swabby.Done
+
+	behaviour.Quit <- struct{}{}
+	<-behaviour.Done
 }
 
 func loadConfig(f string) (Config, error) {
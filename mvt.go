@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+const (
+	MVT_MEDIA_TYPE = "application/vnd.mapbox-vector-tile"
+	MVT_LAYER      = "ships"
+	MVT_VERSION    = 2
+	MVT_EXTENT     = 4096
+	MVT_BUFFER     = 64
+	MVT_MAX_ZOOM   = 22
+	MVT_NO_GROUP   = 255
+	MERCATOR_LAT   = 85.05112878
+)
+
+// Protobuf field numbers and wire types of the Mapbox Vector Tile schema.
+// Reference: https://github.com/mapbox/vector-tile-spec/blob/master/2.1/vector_tile.proto
+const (
+	pbVarint = 0
+	pbBytes  = 2
+
+	mvtTileLayers = 3
+
+	mvtLayerName     = 1
+	mvtLayerFeatures = 2
+	mvtLayerKeys     = 3
+	mvtLayerValues   = 4
+	mvtLayerExtent   = 5
+	mvtLayerVersion  = 15
+
+	mvtFeatureId       = 1
+	mvtFeatureTags     = 2
+	mvtFeatureType     = 3
+	mvtFeatureGeometry = 4
+
+	mvtValueString = 1
+	mvtValueDouble = 3
+	mvtValueUint   = 5
+
+	mvtGeomPoint = 1
+	mvtMoveTo    = 1
+)
+
+// mvtValue is an attribute value, only one of the fields is used as given by kind.
+type mvtValue struct {
+	kind int
+	s    string
+	d    float64
+	u    uint64
+}
+
+// mvtLayer accumulates features, sharing keys and values between them as the format requires.
+type mvtLayer struct {
+	keys     []string
+	keyIndex map[string]uint32
+	values   []mvtValue
+	valIndex map[mvtValue]uint32
+	features [][]byte
+}
+
+// GetShipsTile encodes the ships inside web mercator tile z, x, y as a single layer vector tile of point features.
+// Ships within MVT_BUFFER of the tile edge are included so symbols drawn across tile edges are not clipped.
+func (s *Ships) GetShipsTile(z int, x int, y int, f ShipFilter) ([]byte, error) {
+	if z < 0 || z > MVT_MAX_ZOOM {
+		return nil, fmt.Errorf("zoom out of range")
+	}
+
+	n := 1 << z
+	if x < 0 || x >= n || y < 0 || y >= n {
+		return nil, fmt.Errorf("tile out of range")
+	}
+
+	// The buffer wraps across the antimeridian so tiles at the edge of the map include ships drawn across it.
+	buffer := float64(MVT_BUFFER) / MVT_EXTENT
+	bbox := expandBbox([2][2]float64{
+		{tileLat(float64(y+1)+buffer, n), tileLon(float64(x), n)},
+		{tileLat(float64(y)-buffer, n), tileLon(float64(x+1), n)},
+	}, 0, buffer*360/float64(n))
+
+	ships, err := s.GetShipsInBox(bbox)
+	if err != nil {
+		return nil, err
+	}
+	ships = s.FilterShips(ships, f)
+
+	layer := &mvtLayer{
+		keyIndex: map[string]uint32{},
+		valIndex: map[mvtValue]uint32{},
+	}
+
+	s.StateLock.RLock()
+	for _, ship := range ships {
+		if len(ship.LatLon) != 2 {
+			continue
+		}
+
+		px, py := tilePixel(ship.LatLon, x, y, n)
+
+		group := uint64(MVT_NO_GROUP)
+		if class, ok := ShipTypes[ship.ShipType]; ok {
+			group = uint64(class.GroupId)
+		}
+
+		var tags []uint32
+		tags = layer.tag(tags, "name", mvtValue{kind: mvtValueString, s: ship.Name})
+		tags = layer.tag(tags, "shipType", mvtValue{kind: mvtValueUint, u: uint64(ship.ShipType)})
+		tags = layer.tag(tags, "group", mvtValue{kind: mvtValueUint, u: group})
+		tags = layer.tag(tags, "navStatus", mvtValue{kind: mvtValueUint, u: uint64(ship.NavStatus)})
+		tags = layer.tag(tags, "marker", mvtValue{kind: mvtValueUint, u: uint64(ship.Marker)})
+		tags = layer.tag(tags, "rotation", mvtValue{kind: mvtValueUint, u: uint64(max(ship.Rotation, 0))})
+		if ship.Heading != HEADING_RESET {
+			tags = layer.tag(tags, "heading", mvtValue{kind: mvtValueUint, u: uint64(max(ship.Heading, 0))})
+		}
+		if ship.SOG < SOG_NOT_AVAILABLE {
+			tags = layer.tag(tags, "sog", mvtValue{kind: mvtValueDouble, d: ship.SOG})
+			tags = layer.tag(tags, "cog", mvtValue{kind: mvtValueDouble, d: ship.COG})
+		}
+		tags = layer.tag(tags, "lastUpdate", mvtValue{kind: mvtValueUint, u: uint64(max(ship.LastUpdate, 0))})
+
+		layer.addPoint(uint64(ship.MMSI), tags, px, py)
+	}
+	s.StateLock.RUnlock()
+
+	return appendBytesField(nil, mvtTileLayers, layer.encode()), nil
+}
+
+// tileLon returns the longitude of the west edge of tile column x, fractional columns fall within the tile.
+func tileLon(x float64, n int) float64 {
+	return x/float64(n)*360 - 180
+}
+
+// tileLat returns the latitude of the north edge of tile row y, clamped to the web mercator limit.
+func tileLat(y float64, n int) float64 {
+	lat := degrees(math.Atan(math.Sinh(math.Pi * (1 - 2*y/float64(n)))))
+	return max(min(lat, MERCATOR_LAT), -MERCATOR_LAT)
+}
+
+// tilePixel projects latLon into the extent of tile x, y, with y increasing southward.
+// Positions across the antimeridian from the tile are projected beyond its nearer edge.
+func tilePixel(latLon []float64, x int, y int, n int) (int64, int64) {
+	lat := max(min(latLon[0], MERCATOR_LAT), -MERCATOR_LAT)
+	wx := (latLon[1] + 180) / 360 * float64(n)
+	if centre := float64(x) + 0.5; wx-centre > float64(n)/2 {
+		wx -= float64(n)
+	} else if centre-wx > float64(n)/2 {
+		wx += float64(n)
+	}
+	wy := (1 - math.Log(math.Tan(radians(lat))+1/math.Cos(radians(lat)))/math.Pi) / 2 * float64(n)
+
+	return int64(math.Round((wx - float64(x)) * MVT_EXTENT)), int64(math.Round((wy - float64(y)) * MVT_EXTENT))
+}
+
+// tag appends the key and value indexes of an attribute to tags.
+func (l *mvtLayer) tag(tags []uint32, key string, v mvtValue) []uint32 {
+	k, ok := l.keyIndex[key]
+	if !ok {
+		k = uint32(len(l.keys))
+		l.keys = append(l.keys, key)
+		l.keyIndex[key] = k
+	}
+
+	i, ok := l.valIndex[v]
+	if !ok {
+		i = uint32(len(l.values))
+		l.values = append(l.values, v)
+		l.valIndex[v] = i
+	}
+
+	return append(tags, k, i)
+}
+
+func (l *mvtLayer) addPoint(id uint64, tags []uint32, px int64, py int64) {
+	geometry := []uint32{mvtMoveTo | 1<<3, zigzag(px), zigzag(py)}
+
+	var f []byte
+	f = appendVarintField(f, mvtFeatureId, id)
+	f = appendPackedField(f, mvtFeatureTags, tags)
+	f = appendVarintField(f, mvtFeatureType, mvtGeomPoint)
+	f = appendPackedField(f, mvtFeatureGeometry, geometry)
+
+	l.features = append(l.features, f)
+}
+
+func (l *mvtLayer) encode() []byte {
+	var b []byte
+	b = appendVarintField(b, mvtLayerVersion, MVT_VERSION)
+	b = appendBytesField(b, mvtLayerName, []byte(MVT_LAYER))
+
+	for _, f := range l.features {
+		b = appendBytesField(b, mvtLayerFeatures, f)
+	}
+
+	for _, k := range l.keys {
+		b = appendBytesField(b, mvtLayerKeys, []byte(k))
+	}
+
+	for _, v := range l.values {
+		var vb []byte
+		switch v.kind {
+		case mvtValueString:
+			vb = appendBytesField(vb, mvtValueString, []byte(v.s))
+		case mvtValueDouble:
+			vb = binary.AppendUvarint(vb, mvtValueDouble<<3|1)
+			vb = binary.LittleEndian.AppendUint64(vb, math.Float64bits(v.d))
+		case mvtValueUint:
+			vb = appendVarintField(vb, mvtValueUint, v.u)
+		}
+		b = appendBytesField(b, mvtLayerValues, vb)
+	}
+
+	return appendVarintField(b, mvtLayerExtent, MVT_EXTENT)
+}
+
+func appendVarintField(b []byte, field int, v uint64) []byte {
+	b = binary.AppendUvarint(b, uint64(field<<3|pbVarint))
+	return binary.AppendUvarint(b, v)
+}
+
+func appendBytesField(b []byte, field int, data []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(field<<3|pbBytes))
+	b = binary.AppendUvarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+func appendPackedField(b []byte, field int, values []uint32) []byte {
+	var packed []byte
+	for _, v := range values {
+		packed = binary.AppendUvarint(packed, uint64(v))
+	}
+	return appendBytesField(b, field, packed)
+}
+
+// zigzag encodes a signed integer so small magnitudes of either sign are small varints.
+func zigzag(v int64) uint32 {
+	return uint32((v << 1) ^ (v >> 63))
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/binary"
+	"maps"
+	"testing"
+)
+
+type pbField struct {
+	num   int
+	value uint64
+	bytes []byte
+}
+
+// pbFields splits an encoded protobuf message into its fields, supporting the wire types used by the encoders.
+func pbFields(t *testing.T, b []byte) []pbField {
+	t.Helper()
+
+	fields := []pbField{}
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			t.Fatalf("could not read field key")
+		}
+		b = b[n:]
+
+		f := pbField{num: int(key >> 3)}
+		switch key & 7 {
+		case pbVarint:
+			f.value, n = binary.Uvarint(b)
+			if n <= 0 {
+				t.Fatalf("could not read varint of field %d", f.num)
+			}
+			b = b[n:]
+		case pbBytes:
+			length, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < length {
+				t.Fatalf("could not read bytes of field %d", f.num)
+			}
+			f.bytes = b[n : n+int(length)]
+			b = b[n+int(length):]
+		case 1:
+			f.value = binary.LittleEndian.Uint64(b)
+			b = b[8:]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+		fields = append(fields, f)
+	}
+
+	return fields
+}
+
+// tileFeature is a decoded point feature of a ships tile.
+type tileFeature struct {
+	x     int64
+	group uint64
+}
+
+func decodeShipsTile(t *testing.T, b []byte) map[uint64]tileFeature {
+	t.Helper()
+
+	features := map[uint64]tileFeature{}
+	for _, tile := range pbFields(t, b) {
+		if tile.num != mvtTileLayers {
+			t.Fatalf("unexpected tile field %d", tile.num)
+		}
+
+		var keys []string
+		var values []uint64
+		var encoded [][]byte
+		for _, f := range pbFields(t, tile.bytes) {
+			switch f.num {
+			case mvtLayerName:
+				if string(f.bytes) != MVT_LAYER {
+					t.Errorf("layer name = %q, want %q", f.bytes, MVT_LAYER)
+				}
+			case mvtLayerKeys:
+				keys = append(keys, string(f.bytes))
+			case mvtLayerValues:
+				values = append(values, pbFields(t, f.bytes)[0].value)
+			case mvtLayerFeatures:
+				encoded = append(encoded, f.bytes)
+			}
+		}
+
+		for _, e := range encoded {
+			var id uint64
+			var feature tileFeature
+			for _, f := range pbFields(t, e) {
+				switch f.num {
+				case mvtFeatureId:
+					id = f.value
+				case mvtFeatureTags:
+					tags := []uint64{}
+					for p := f.bytes; len(p) > 0; {
+						v, n := binary.Uvarint(p)
+						tags = append(tags, v)
+						p = p[n:]
+					}
+					for i := 0; i+1 < len(tags); i += 2 {
+						if keys[tags[i]] == "group" {
+							feature.group = values[tags[i+1]]
+						}
+					}
+				case mvtFeatureGeometry:
+					geometry := []uint64{}
+					for p := f.bytes; len(p) > 0; {
+						v, n := binary.Uvarint(p)
+						geometry = append(geometry, v)
+						p = p[n:]
+					}
+					if len(geometry) != 3 || geometry[0] != mvtMoveTo|1<<3 {
+						t.Fatalf("feature %d geometry = %v, want a single point", id, geometry)
+					}
+					feature.x = int64(geometry[1]>>1) ^ -int64(geometry[1]&1)
+				}
+			}
+			features[id] = feature
+		}
+	}
+
+	return features
+}
+
+func TestGetShipsTile(t *testing.T) {
+	s := newTestShips(map[int][]float64{
+		1: {51.9, 4.1},    // Rotterdam
+		2: {10, 179.9},    // west of the antimeridian
+		3: {10, -179.9},   // east of the antimeridian
+		4: {10, -170},     // clear of the antimeridian
+		5: {-33.9, 151.2}, // Sydney
+	})
+	s.State[1].ShipType = 70
+	s.State[2].ShipType = 80
+	s.State[3].ShipType = 1000 // outside the AIS ship types
+
+	tests := []struct {
+		name    string
+		z, x, y int
+		want    map[uint64]tileFeature
+	}{
+		{
+			name: "world",
+			z:    0, x: 0, y: 0,
+			want: map[uint64]tileFeature{
+				1: {x: 2095, group: 0},
+				2: {x: 4095, group: 7},
+				3: {x: 1, group: MVT_NO_GROUP},
+				4: {x: 114, group: 3},
+				5: {x: 3768, group: 3},
+			},
+		},
+		{
+			name: "east edge",
+			z:    2, x: 3, y: 1,
+			want: map[uint64]tileFeature{
+				2: {x: 4091, group: 7},
+				3: {x: 4101, group: MVT_NO_GROUP},
+			},
+		},
+		{
+			name: "west edge",
+			z:    2, x: 0, y: 1,
+			want: map[uint64]tileFeature{
+				2: {x: -5, group: 7},
+				3: {x: 5, group: MVT_NO_GROUP},
+				4: {x: 455, group: 3},
+			},
+		},
+		{
+			name: "empty",
+			z:    2, x: 1, y: 3,
+			want: map[uint64]tileFeature{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := s.GetShipsTile(tt.z, tt.x, tt.y, ShipFilter{})
+			if err != nil {
+				t.Fatalf("GetShipsTile(%d, %d, %d) failed: %s", tt.z, tt.x, tt.y, err.Error())
+			}
+
+			got := decodeShipsTile(t, b)
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("GetShipsTile(%d, %d, %d) = %v, want %v", tt.z, tt.x, tt.y, got, tt.want)
+			}
+		})
+	}
+
+	_, err := s.GetShipsTile(2, 4, 0, ShipFilter{})
+	if err == nil {
+		t.Errorf("GetShipsTile(2, 4, 0) succeeded, want tile out of range")
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"slices"
+)
+
+const (
+	NEAREST_DEFAULT_K = 10
+	NEAREST_MAX_K     = 100
+)
+
+// NearbyShip is a ship with its great-circle distance and initial bearing from the point searched around.
+type NearbyShip struct {
+	State
+	DistanceNm float64 `json:"distanceNm"`
+	Bearing    float64 `json:"bearing"`
+}
+
+// GetNearestShips returns the k ships closest to centre ordered nearest first, leaving out exclude.
+// Geocache buckets are searched in rings expanding outward from the bucket containing centre,
+// stopping once no unsearched bucket can hold a ship closer than the kth found so far.
+func (s *Ships) GetNearestShips(centre []float64, k int, exclude int) ([]NearbyShip, error) {
+	if !validBbox([2][2]float64{{centre[0], centre[1]}, {centre[0], centre[1]}}) {
+		return nil, fmt.Errorf("centre out of range")
+	}
+
+	if k < 1 {
+		return nil, fmt.Errorf("k must be greater than 0")
+	}
+
+	rows, cols, latStep, lonStep := geocacheGrid()
+	centreRow := gridIndex(centre[0], LATMIN, latStep, rows)
+
+	nearest := make([]NearbyShip, 0)
+
+	for radius := 0; ; radius++ {
+		mmsis := s.Geo.Ring(centre, radius)
+
+		s.StateLock.RLock()
+		for _, mmsi := range mmsis {
+			ship, ok := s.State[mmsi]
+			if !ok || mmsi == exclude || len(ship.LatLon) != 2 {
+				continue
+			}
+			nearest = append(nearest, NearbyShip{
+				State:      *ship,
+				DistanceNm: distanceNm(centre, ship.LatLon),
+				Bearing:    bearing(centre, ship.LatLon),
+			})
+		}
+		s.StateLock.RUnlock()
+
+		allRows := centreRow-radius <= 0 && centreRow+radius >= rows-1
+		allCols := 2*radius+1 >= cols
+		if allRows && allCols {
+			break
+		}
+
+		if len(nearest) >= k {
+			slices.SortFunc(nearest, func(a, b NearbyShip) int {
+				return cmp.Compare(a.DistanceNm, b.DistanceNm)
+			})
+			nearest = nearest[:k]
+
+			if nearest[k-1].DistanceNm <= unsearchedNm(centre, radius, allRows, allCols, latStep, lonStep) {
+				break
+			}
+		}
+	}
+
+	slices.SortFunc(nearest, func(a, b NearbyShip) int {
+		return cmp.Compare(a.DistanceNm, b.DistanceNm)
+	})
+
+	return nearest[:min(k, len(nearest))], nil
+}
+
+// GetShipNearest returns the k ships closest to mmsi, not including itself.
+func (s *Ships) GetShipNearest(mmsi int, k int) ([]NearbyShip, error) {
+	s.StateLock.RLock()
+	ship, ok := s.State[mmsi]
+	var latLon []float64
+	if ok {
+		latLon = ship.LatLon
+	}
+	s.StateLock.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("mmsi does not exist in ship state")
+	}
+
+	if len(latLon) != 2 {
+		return nil, fmt.Errorf("mmsi has no position")
+	}
+
+	return s.GetNearestShips(latLon, k, mmsi)
+}
+
+// unsearchedNm returns a lower bound on the distance from centre to any bucket outside the rings searched so far.
+// Unsearched rows are at least radius bucket heights away, unsearched columns at least the distance to the meridian radius bucket widths away.
+func unsearchedNm(centre []float64, radius int, allRows bool, allCols bool, latStep float64, lonStep float64) float64 {
+	bound := math.Inf(1)
+
+	if !allRows {
+		bound = float64(radius) * latStep * 60
+	}
+
+	if !allCols {
+		dLon := math.Min(float64(radius)*lonStep, 90)
+		meridianNm := EARTH_RADIUS_NM * math.Asin(math.Cos(radians(centre[0]))*math.Sin(radians(dLon)))
+		bound = math.Min(bound, meridianNm)
+	}
+
+	return bound
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"cmp"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"sync"
+)
+
+const (
+	PLAYBACK_LOOKBACK_HOURS  = 24
+	PLAYBACK_MAX_GAP_SECONDS = 1800
+	PLAYBACK_MARGIN_DEGREES  = TRACK_CELL_DEGREES
+	PLAYBACK_TICK_MS         = 250
+	PLAYBACK_DEFAULT_SPEED   = 60
+	PLAYBACK_MAX_SPEED       = 86400
+	PLAYBACK_MAX_HOURS       = 48
+	PLAYBACK_MAX_FRAMES      = 100000
+)
+
+// errPlaybackLimit is returned for playbacks spanning more than PLAYBACK_MAX_HOURS or PLAYBACK_MAX_FRAMES,
+// as every frame is held in memory for the length of the stream.
+var errPlaybackLimit = errors.New("playback limit exceeded")
+
+// PlaybackFrame is a single position in a playback stream.
+type PlaybackFrame struct {
+	MMSI      int       `json:"mmsi"`
+	LatLon    []float64 `json:"latlon"`
+	Timestamp int64     `json:"timestamp"`
+}
+
+// Playback is a stream of stored positions replayed in time order at Speed times real time.
+// Clock is the playback time, frames at or before Clock have been sent.
+type Playback struct {
+	ID     string
+	Lock   sync.Mutex
+	Frames []PlaybackFrame
+	From   int64
+	To     int64
+	Clock  float64
+	Speed  float64
+	Paused bool
+	next   int
+}
+
+// Playbacks holds the playback streams currently open, so they can be paused, sought and sped up while streaming.
+type Playbacks struct {
+	Lock     sync.RWMutex
+	Sessions map[string]*Playback
+}
+
+// GetShipsInBoxAt reconstructs the ships inside bbox at a past unix timestamp from the track store.
+// Without the track store, the history held in memory of ships currently within PLAYBACK_MARGIN_DEGREES of bbox is used instead.
+// A ship's position is interpolated between the stored positions either side of at when they are at most PLAYBACK_MAX_GAP_SECONDS apart.
+// Otherwise the last position within PLAYBACK_LOOKBACK_HOURS is used, as positions are only stored once a ship moves.
+// Name and ship type are taken from current state, speed and course are derived from the stored positions.
+func (s *Ships) GetShipsInBoxAt(bbox [2][2]float64, at int64, ts *TrackStore) ([]*State, error) {
+	if !validBbox(bbox) {
+		return nil, fmt.Errorf("bounding box out of range")
+	}
+
+	// Ships inside bbox at the time may have stored positions either side of it just outside bbox.
+	search := expandBbox(bbox, PLAYBACK_MARGIN_DEGREES, PLAYBACK_MARGIN_DEGREES)
+
+	from := at - PLAYBACK_LOOKBACK_HOURS*3600
+	to := at + PLAYBACK_MAX_GAP_SECONDS
+
+	var tracks map[int][]History
+	if ts.Tracks.Enable {
+		t, err := ts.QueryArea(search, from, to)
+		if err != nil {
+			return nil, err
+		}
+		tracks = t
+	} else {
+		candidates := []int{}
+		for _, b := range splitBbox(search) {
+			candidates = append(candidates, s.Geo.Search(b)...)
+		}
+		tracks = s.historyBetween(candidates, from, to)
+	}
+
+	ships := make([]*State, 0)
+
+	s.StateLock.RLock()
+	defer s.StateLock.RUnlock()
+
+	for mmsi, track := range tracks {
+		ship, ok := stateAt(mmsi, track, at)
+		if !ok || !inBbox(ship.LatLon, bbox) {
+			continue
+		}
+
+		if current, ok := s.State[mmsi]; ok {
+			ship.Name = current.Name
+			ship.ShipType = current.ShipType
+		}
+
+		ships = append(ships, ship)
+	}
+
+	return ships, nil
+}
+
+// stateAt returns the state of a ship at a unix timestamp from its track, ordered oldest first.
+func stateAt(mmsi int, track []History, at int64) (*State, bool) {
+	before := -1
+	for i, h := range track {
+		if h.Timestamp > at {
+			break
+		}
+		before = i
+	}
+
+	if before < 0 {
+		return nil, false
+	}
+
+	ship := &State{
+		MMSI:       mmsi,
+		LatLon:     track[before].LatLon,
+		Heading:    HEADING_RESET,
+		NavStatus:  NAV_STATUS_NOT_DEFINED,
+		LastUpdate: track[before].Timestamp,
+	}
+
+	if before+1 < len(track) && track[before+1].Timestamp-track[before].Timestamp <= PLAYBACK_MAX_GAP_SECONDS {
+		a := track[before]
+		b := track[before+1]
+		elapsed := float64(b.Timestamp - a.Timestamp)
+
+		if elapsed > 0 {
+			ship.LatLon = interpolate(a, b, at)
+			ship.SOG = distanceNm(a.LatLon, b.LatLon) / (elapsed / 3600)
+			ship.COG = bearing(a.LatLon, b.LatLon)
+		}
+	}
+
+	if ship.SOG > MOVING_SPEED_THRESHOLD {
+		ship.Marker = 1
+		ship.Rotation = int(math.Round(ship.COG))
+	} else {
+		ship.Marker = 2
+	}
+
+	return ship, true
+}
+
+func NewPlaybacks() *Playbacks {
+	return &Playbacks{
+		Sessions: map[string]*Playback{},
+	}
+}
+
+// NewPlayback registers a playback of frames, which must be ordered oldest first.
+func (p *Playbacks) NewPlayback(frames []PlaybackFrame, from int64, to int64, speed float64) (*Playback, error) {
+	b := make([]byte, 8)
+	_, err := rand.Read(b)
+	if err != nil {
+		return nil, fmt.Errorf("could not generate playback id: %w", err)
+	}
+
+	pb := &Playback{
+		ID:     hex.EncodeToString(b),
+		Frames: frames,
+		From:   from,
+		To:     to,
+		Clock:  float64(from),
+		Speed:  speed,
+	}
+
+	p.Lock.Lock()
+	p.Sessions[pb.ID] = pb
+	p.Lock.Unlock()
+
+	return pb, nil
+}
+
+func (p *Playbacks) Get(id string) (*Playback, bool) {
+	p.Lock.RLock()
+	defer p.Lock.RUnlock()
+
+	pb, ok := p.Sessions[id]
+	return pb, ok
+}
+
+func (p *Playbacks) Remove(id string) {
+	p.Lock.Lock()
+	delete(p.Sessions, id)
+	p.Lock.Unlock()
+}
+
+// Advance moves the clock forward by elapsed real milliseconds unless paused and returns the frames now due.
+// Returns false once every frame has been sent and the clock has reached To.
+func (pb *Playback) Advance(elapsedMs int64) ([]PlaybackFrame, bool) {
+	pb.Lock.Lock()
+	defer pb.Lock.Unlock()
+
+	if !pb.Paused {
+		pb.Clock = min(pb.Clock+pb.Speed*float64(elapsedMs)/1000, float64(pb.To))
+	}
+
+	start := pb.next
+	for pb.next < len(pb.Frames) && float64(pb.Frames[pb.next].Timestamp) <= pb.Clock {
+		pb.next++
+	}
+
+	return pb.Frames[start:pb.next], pb.next < len(pb.Frames) || pb.Clock < float64(pb.To)
+}
+
+// SeekTo moves the clock to at, clamped to the playback window. Frames before at are skipped.
+func (pb *Playback) SeekTo(at int64) {
+	pb.Lock.Lock()
+	defer pb.Lock.Unlock()
+
+	at = min(max(at, pb.From), pb.To)
+	pb.Clock = float64(at)
+	pb.next = sort.Search(len(pb.Frames), func(i int) bool {
+		return pb.Frames[i].Timestamp >= at
+	})
+}
+
+func (pb *Playback) SetPaused(paused bool) {
+	pb.Lock.Lock()
+	pb.Paused = paused
+	pb.Lock.Unlock()
+}
+
+func (pb *Playback) SetSpeed(speed float64) {
+	pb.Lock.Lock()
+	pb.Speed = speed
+	pb.Lock.Unlock()
+}
+
+// GetPlaybackFrames returns the stored positions of the given ships, or of every ship inside bbox when mmsis is empty, between from and to.
+// Positions come from the track store when enabled, otherwise from ship history.
+// Without the track store, a bbox only plays back ships currently within PLAYBACK_MARGIN_DEGREES of it, found through the geocache.
+// Frames are ordered oldest first.
+func (d *Dock) GetPlaybackFrames(mmsis []int, bbox *[2][2]float64, from int64, to int64) ([]PlaybackFrame, error) {
+	if len(mmsis) == 0 && bbox == nil {
+		return nil, fmt.Errorf("playback requires mmsis or a bounding box")
+	}
+
+	if bbox != nil && !validBbox(*bbox) {
+		return nil, fmt.Errorf("bounding box out of range")
+	}
+
+	if to-from > PLAYBACK_MAX_HOURS*3600 {
+		return nil, fmt.Errorf("%w: range spans more than %d hours", errPlaybackLimit, PLAYBACK_MAX_HOURS)
+	}
+
+	tracks := map[int][]History{}
+	switch {
+	case d.Tracks.Enable && len(mmsis) > 0:
+		for _, mmsi := range mmsis {
+			history, err := d.TrackStore.Query(mmsi, from, to)
+			if err != nil {
+				return nil, err
+			}
+			slices.Reverse(history)
+			tracks[mmsi] = history
+		}
+	case d.Tracks.Enable:
+		t, err := d.TrackStore.QueryArea(*bbox, from, to)
+		if err != nil {
+			return nil, err
+		}
+		tracks = t
+	case len(mmsis) > 0:
+		tracks = d.Ships.historyBetween(mmsis, from, to)
+	default:
+		candidates := []int{}
+		for _, b := range splitBbox(expandBbox(*bbox, PLAYBACK_MARGIN_DEGREES, PLAYBACK_MARGIN_DEGREES)) {
+			candidates = append(candidates, d.Ships.Geo.Search(b)...)
+		}
+		tracks = d.Ships.historyBetween(candidates, from, to)
+	}
+
+	frames := make([]PlaybackFrame, 0)
+	for mmsi, track := range tracks {
+		for _, h := range track {
+			if bbox != nil && !inBbox(h.LatLon, *bbox) {
+				continue
+			}
+			if len(frames) == PLAYBACK_MAX_FRAMES {
+				return nil, fmt.Errorf("%w: more than %d frames", errPlaybackLimit, PLAYBACK_MAX_FRAMES)
+			}
+			frames = append(frames, PlaybackFrame{MMSI: mmsi, LatLon: h.LatLon, Timestamp: h.Timestamp})
+		}
+	}
+
+	slices.SortStableFunc(frames, func(a, b PlaybackFrame) int {
+		if c := cmp.Compare(a.Timestamp, b.Timestamp); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.MMSI, b.MMSI)
+	})
+
+	return frames, nil
+}
+
+// historyBetween returns the history of the given ships between from and to ordered oldest first.
+func (s *Ships) historyBetween(mmsis []int, from int64, to int64) map[int][]History {
+	s.HistoryLock.RLock()
+	defer s.HistoryLock.RUnlock()
+
+	tracks := map[int][]History{}
+	for _, mmsi := range mmsis {
+		buffer, ok := s.History[mmsi]
+		if !ok {
+			continue
+		}
+
+		history := buffer.Points()
+		track := []History{}
+		for i := len(history) - 1; i >= 0; i-- {
+			if history[i].Timestamp >= from && history[i].Timestamp <= to {
+				track = append(track, history[i])
+			}
+		}
+		if len(track) > 0 {
+			tracks[mmsi] = track
+		}
+	}
+
+	return tracks
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestGetPlaybackFramesInMemory(t *testing.T) {
+	now := time.Now().Unix()
+
+	// Ship 1 is in the bbox, ship 2 is just outside its margin and ship 3 has since left the area.
+	d := &Dock{Ships: newTestShips(map[int][]float64{
+		1: {51.9, 4.1},
+		2: {50.0, 4.1},
+		3: {55.0, 4.1},
+	})}
+	d.Ships.History[1] = NewHistoryBufferFrom([]History{
+		NewHistory([]float64{51.9, 4.1}, now-60),
+		NewHistory([]float64{51.5, 3.5}, now-600),
+		NewHistory([]float64{51.8, 4.0}, now-3600),
+	})
+	d.Ships.History[2] = NewHistoryBufferFrom([]History{
+		NewHistory([]float64{50.0, 4.1}, now-60),
+	})
+	d.Ships.History[3] = NewHistoryBufferFrom([]History{
+		NewHistory([]float64{55.0, 4.1}, now-60),
+		NewHistory([]float64{51.9, 4.2}, now-7200),
+	})
+
+	crowded := make([]History, PLAYBACK_MAX_FRAMES+1)
+	for i := range crowded {
+		crowded[i] = NewHistory([]float64{51.9, 4.1}, now-int64(i))
+	}
+	// Ship 4 is not in the geocache, so only plays back when requested by mmsi.
+	d.Ships.History[4] = NewHistoryBufferFrom(crowded)
+
+	bbox := [2][2]float64{{51.7, 3.9}, {52.0, 4.3}}
+
+	tests := []struct {
+		name    string
+		mmsis   []int
+		bbox    *[2][2]float64
+		from    int64
+		want    []int64
+		wantErr bool
+	}{
+		{name: "mmsi", mmsis: []int{1}, from: now - 3600, want: []int64{now - 3600, now - 600, now - 60}},
+		{name: "mmsi and bbox", mmsis: []int{1, 3}, bbox: &bbox, from: now - 7200, want: []int64{now - 7200, now - 3600, now - 60}},
+		{name: "bbox", bbox: &bbox, from: now - 7200, want: []int64{now - 3600, now - 60}},
+		{name: "span limit", mmsis: []int{1}, from: now - PLAYBACK_MAX_HOURS*3600 - 1, wantErr: true},
+		{name: "frame limit", mmsis: []int{4}, from: now - PLAYBACK_MAX_HOURS*3600, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frames, err := d.GetPlaybackFrames(tt.mmsis, tt.bbox, tt.from, now)
+			if tt.wantErr {
+				if !errors.Is(err, errPlaybackLimit) {
+					t.Errorf("GetPlaybackFrames() error = %v, want %v", err, errPlaybackLimit)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetPlaybackFrames() failed: %s", err.Error())
+			}
+
+			got := []int64{}
+			for _, f := range frames {
+				got = append(got, f.Timestamp)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("GetPlaybackFrames() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetShipsInBoxAtInMemory(t *testing.T) {
+	now := time.Now().Unix()
+	at := now - 1800
+
+	s := newTestShips(map[int][]float64{1: {51.9, 4.1}, 2: {51.8, 4.2}, 3: {55.0, 4.1}})
+	s.State[1].Name = "MAAS"
+
+	// Ship 1 is interpolated between two positions, ship 2 has only moved since and ship 3 was inside bbox but has since moved beyond the search margin.
+	s.History[1] = NewHistoryBufferFrom([]History{
+		NewHistory([]float64{51.9, 4.1}, now-1200),
+		NewHistory([]float64{51.8, 4.1}, now-2400),
+	})
+	s.History[2] = NewHistoryBufferFrom([]History{
+		NewHistory([]float64{51.8, 4.2}, now-60),
+		NewHistory([]float64{51.7, 4.2}, now-7200),
+	})
+	s.History[3] = NewHistoryBufferFrom([]History{
+		NewHistory([]float64{55.0, 4.1}, now-60),
+		NewHistory([]float64{51.9, 4.0}, now-3600),
+	})
+
+	bbox := [2][2]float64{{51.6, 3.9}, {52.0, 4.3}}
+	ships, err := s.GetShipsInBoxAt(bbox, at, NewTrackStore(NewTracksDefaults()))
+	if err != nil {
+		t.Fatalf("GetShipsInBoxAt() failed: %s", err.Error())
+	}
+
+	got := map[int]*State{}
+	for _, ship := range ships {
+		got[ship.MMSI] = ship
+	}
+
+	if len(got) != 2 || got[1] == nil || got[2] == nil {
+		t.Fatalf("GetShipsInBoxAt() returned %d ships, want ships 1 and 2", len(ships))
+	}
+
+	if math.Abs(got[1].LatLon[0]-51.85) > 1e-6 || got[1].Name != "MAAS" {
+		t.Errorf("GetShipsInBoxAt() ship 1 = %v %q, want [51.85 4.1] \"MAAS\"", got[1].LatLon, got[1].Name)
+	}
+
+	if !slices.Equal(got[2].LatLon, []float64{51.7, 4.2}) {
+		t.Errorf("GetShipsInBoxAt() ship 2 = %v, want [51.7 4.2]", got[2].LatLon)
+	}
+}
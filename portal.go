@@ -3,14 +3,20 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
+
+	"nhooyr.io/websocket"
 )
 
 type Portal struct {
@@ -45,15 +51,74 @@ func ListenAndServe(ctx context.Context, dock *Dock, p Portal, g Google) {
 	mux.HandleFunc("GET /shipHistory/{mmsi}", func(w http.ResponseWriter, r *http.Request) {
 		shipHistory(w, r, dock)
 	})
+	mux.HandleFunc("GET /shipVoyages/{mmsi}", func(w http.ResponseWriter, r *http.Request) {
+		shipVoyages(w, r, dock)
+	})
+	mux.HandleFunc("GET /shipEta/{mmsi}", func(w http.ResponseWriter, r *http.Request) {
+		shipEta(w, r, dock)
+	})
+	mux.HandleFunc("GET /shipRoute/{mmsi}", func(w http.ResponseWriter, r *http.Request) {
+		shipRoute(w, r, dock)
+	})
 	mux.HandleFunc("GET /ships/{sw}/{ne}", func(w http.ResponseWriter, r *http.Request) {
 		shipsBbox(w, r, dock)
 	})
+	mux.HandleFunc("POST /ships/within/polygon", func(w http.ResponseWriter, r *http.Request) {
+		shipsWithinPolygon(w, r, dock)
+	})
+	mux.HandleFunc("GET /ships/within/radius/{centre}/{nm}", func(w http.ResponseWriter, r *http.Request) {
+		shipsWithinRadius(w, r, dock)
+	})
+	mux.HandleFunc("GET /ships/nearest/{centre}", func(w http.ResponseWriter, r *http.Request) {
+		shipsNearest(w, r, dock)
+	})
+	mux.HandleFunc("GET /shipNearest/{mmsi}", func(w http.ResponseWriter, r *http.Request) {
+		shipNearest(w, r, dock)
+	})
+	mux.HandleFunc("GET /shipsByDestination/{locode}", func(w http.ResponseWriter, r *http.Request) {
+		shipsByDestination(w, r, dock)
+	})
 	mux.HandleFunc("GET /searchFields", func(w http.ResponseWriter, r *http.Request) {
 		searchFields(w, r, dock)
 	})
+	mux.HandleFunc("GET /shipEncounters/{mmsi}", func(w http.ResponseWriter, r *http.Request) {
+		shipEncounters(w, r, dock)
+	})
+	mux.HandleFunc("GET /encounters/{sw}/{ne}", func(w http.ResponseWriter, r *http.Request) {
+		encountersBbox(w, r, dock)
+	})
+	mux.HandleFunc("GET /history/area/{sw}/{ne}", func(w http.ResponseWriter, r *http.Request) {
+		areaHistoryBbox(w, r, dock)
+	})
+	mux.HandleFunc("POST /history/area", func(w http.ResponseWriter, r *http.Request) {
+		areaHistoryPolygon(w, r, dock)
+	})
+	mux.HandleFunc("GET /playback", func(w http.ResponseWriter, r *http.Request) {
+		playback(w, r, dock)
+	})
+	mux.HandleFunc("POST /playback/{id}", func(w http.ResponseWriter, r *http.Request) {
+		playbackControl(w, r, dock)
+	})
+	mux.HandleFunc("GET /live", func(w http.ResponseWriter, r *http.Request) {
+		live(w, r, dock)
+	})
+	mux.HandleFunc("GET /events", func(w http.ResponseWriter, r *http.Request) {
+		events(w, r, dock)
+	})
+	mux.HandleFunc("GET /tiles/{z}/{x}/{y}", func(w http.ResponseWriter, r *http.Request) {
+		shipsTile(w, r, dock)
+	})
+	mux.HandleFunc("GET /anomalies", func(w http.ResponseWriter, r *http.Request) {
+		anomalies(w, r, dock)
+	})
 	mux.HandleFunc("GET /shipMeta", shipMeta)
 
-	server := &http.Server{Addr: p.ListenAddr, Handler: mux}
+	// Requests inherit ctx so long lived connections such as /live end on shutdown, which does not wait for hijacked connections.
+	server := &http.Server{
+		Addr:        p.ListenAddr,
+		Handler:     mux,
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
 	go func() {
 		err := server.ListenAndServe()
 		if err != nil && err != http.ErrServerClosed {
@@ -114,6 +179,16 @@ func shipInfoWindow(w http.ResponseWriter, r *http.Request, d *Dock) {
 		fmt.Printf("shipInfo handler failed: %s\n", err.Error())
 	}
 
+	res.Encounters, err = d.Ships.GetShipEncounters(mmsi, d.Encounter)
+	if err != nil {
+		fmt.Printf("shipInfo handler failed: %s\n", err.Error())
+	}
+
+	res.Eta, err = d.Ships.PredictEta(mmsi, d.Eta, d.Voyage)
+	if err != nil {
+		fmt.Printf("shipInfo handler failed: %s\n", err.Error())
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	err = json.NewEncoder(w).Encode(res)
 	if err != nil {
@@ -147,11 +222,43 @@ func shipHistory(w http.ResponseWriter, r *http.Request, d *Dock) {
 		return
 	}
 
-	res, err := d.Ships.GetShipHistory(mmsi)
+	from, to, ranged, err := timeRange(r, d.Tracks.RetainDays)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var res []History
+	if ranged && d.Tracks.Enable {
+		res, err = d.TrackStore.Query(mmsi, from, to)
+	} else {
+		res, err = d.Ships.GetShipHistory(mmsi)
+
+		// Without the track store a range is served from the history held in memory.
+		if ranged {
+			res = slices.DeleteFunc(res, func(h History) bool {
+				return h.Timestamp < from || h.Timestamp > to
+			})
+		}
+	}
 	if err != nil {
 		fmt.Printf("shipHistory handler failed: %s\n", err.Error())
 	}
 
+	opts, err := trackOptions(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if res != nil {
+		res, err = opts.Apply(res)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	err = json.NewEncoder(w).Encode(res)
 	if err != nil {
@@ -159,6 +266,90 @@ func shipHistory(w http.ResponseWriter, r *http.Request, d *Dock) {
 	}
 }
 
+func shipVoyages(w http.ResponseWriter, r *http.Request, d *Dock) {
+	mmsiStr := r.PathValue("mmsi")
+	if mmsiStr == "" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	mmsi, err := strconv.Atoi(mmsiStr)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	res, err := d.Ships.GetShipVoyages(mmsi, d.Voyage)
+	if err != nil {
+		fmt.Printf("shipVoyages handler failed: %s\n", err.Error())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(res)
+	if err != nil {
+		fmt.Printf("shipVoyages handler failed: %s\n", err.Error())
+	}
+}
+
+func shipEta(w http.ResponseWriter, r *http.Request, d *Dock) {
+	mmsiStr := r.PathValue("mmsi")
+	if mmsiStr == "" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	mmsi, err := strconv.Atoi(mmsiStr)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	res, err := d.Ships.PredictEta(mmsi, d.Eta, d.Voyage)
+	if err != nil {
+		fmt.Printf("shipEta handler failed: %s\n", err.Error())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(res)
+	if err != nil {
+		fmt.Printf("shipEta handler failed: %s\n", err.Error())
+	}
+}
+
+func shipRoute(w http.ResponseWriter, r *http.Request, d *Dock) {
+	mmsiStr := r.PathValue("mmsi")
+	if mmsiStr == "" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	mmsi, err := strconv.Atoi(mmsiStr)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	var hours int
+	if hoursStr := r.URL.Query().Get("hours"); hoursStr != "" {
+		hours, err = strconv.Atoi(hoursStr)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	res, err := d.Ships.PredictRoute(mmsi, hours, d.Lanes)
+	if err != nil {
+		fmt.Printf("shipRoute handler failed: %s\n", err.Error())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(res)
+	if err != nil {
+		fmt.Printf("shipRoute handler failed: %s\n", err.Error())
+	}
+}
+
 func shipsBbox(w http.ResponseWriter, r *http.Request, d *Dock) {
 	sw := strings.Split(r.PathValue("sw"), ",")
 	ne := strings.Split(r.PathValue("ne"), ",")
@@ -175,13 +366,121 @@ func shipsBbox(w http.ResponseWriter, r *http.Request, d *Dock) {
 		return
 	}
 
-	res, err := d.Ships.GetShipsInBox(bbox, d.Cache.Geo)
+	filter, err := shipFilter(r.URL.Query())
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Printf("shipsBbox handler failed: %s\n", err.Error())
+		return
+	}
+
+	w.Header().Set("Vary", "Accept")
+	binaryRes := acceptsShipsBinary(r)
+
+	if atStr := r.URL.Query().Get("at"); atStr != "" {
+		at, err := strconv.ParseInt(atStr, 10, 64)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		ships, err := d.Ships.GetShipsInBoxAt(bbox, at, d.TrackStore)
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Printf("shipsBbox handler failed: %s\n", err.Error())
+			return
+		}
+
+		res := d.Ships.FilterShips(ships, filter)
+
+		if binaryRes {
+			// Past positions are reconstructed from stored history and are not dead reckoned, as in the JSON response.
+			err = writeShipsBinary(w, d.Ships.EncodeShipsBinary(d.Ships.DeadReckon(res, DeadReckoning{}), 0, true, nil))
+			if err != nil {
+				fmt.Printf("shipsBbox handler failed: %s\n", err.Error())
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(res)
+		if err != nil {
+			fmt.Printf("shipsBbox handler failed: %s\n", err.Error())
+		}
+		return
+	}
+
+	if sinceStr := r.URL.Query().Get("since"); sinceStr != "" {
+		since, err := strconv.ParseUint(sinceStr, 10, 64)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		ships, delta, err := d.Ships.GetShipsInBoxSince(bbox, since)
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Printf("shipsBbox handler failed: %s\n", err.Error())
+			return
+		}
+
+		// Ships that changed and no longer match the filter are removed from the client's set.
+		matched := d.Ships.FilterShips(ships, filter)
+		if len(matched) < len(ships) {
+			kept := map[*State]bool{}
+			for _, ship := range matched {
+				kept[ship] = true
+			}
+			d.Ships.StateLock.RLock()
+			for _, ship := range ships {
+				if !kept[ship] {
+					delta.Removed = append(delta.Removed, ship.MMSI)
+				}
+			}
+			d.Ships.StateLock.RUnlock()
+		}
+
+		delta.Ships = d.Ships.DeadReckon(matched, d.DeadReckoning)
+
+		if binaryRes {
+			err = writeShipsBinary(w, d.Ships.EncodeShipsBinary(delta.Ships, delta.Version, delta.Full, delta.Removed))
+			if err != nil {
+				fmt.Printf("shipsBbox handler failed: %s\n", err.Error())
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(delta)
+		if err != nil {
+			fmt.Printf("shipsBbox handler failed: %s\n", err.Error())
+		}
+		return
+	}
+
+	// Read the version first, ships updated while the response is built are sent again in the next delta.
+	version := d.Ships.CurrentVersion()
+
+	ships, err := d.Ships.GetShipsInBox(bbox)
 	if err != nil {
 		w.WriteHeader(http.StatusNotFound)
 		fmt.Printf("shipsBbox handler failed: %s\n", err.Error())
 		return
 	}
 
+	ships = d.Ships.FilterShips(ships, filter)
+
+	w.Header().Set("X-Ships-Version", strconv.FormatUint(version, 10))
+
+	res := d.Ships.DeadReckon(ships, d.DeadReckoning)
+
+	if binaryRes {
+		err = writeShipsBinary(w, d.Ships.EncodeShipsBinary(res, version, true, nil))
+		if err != nil {
+			fmt.Printf("shipsBbox handler failed: %s\n", err.Error())
+		}
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	err = json.NewEncoder(w).Encode(res)
 	if err != nil {
@@ -189,51 +488,840 @@ func shipsBbox(w http.ResponseWriter, r *http.Request, d *Dock) {
 	}
 }
 
-func searchFields(w http.ResponseWriter, _ *http.Request, d *Dock) {
+func shipsWithinPolygon(w http.ResponseWriter, r *http.Request, d *Dock) {
+	polygon, err := decodeGeoJSONPolygon(w, r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Printf("shipsWithinPolygon handler failed: %s\n", err.Error())
+		return
+	}
+
+	ships, err := d.Ships.GetShipsInPolygon(polygon)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Printf("shipsWithinPolygon handler failed: %s\n", err.Error())
+		return
+	}
+
+	res := d.Ships.DeadReckon(ships, d.DeadReckoning)
+
 	w.Header().Set("Content-Type", "application/json")
-	err := json.NewEncoder(w).Encode(d.Cache.Search.List)
+	err = json.NewEncoder(w).Encode(res)
 	if err != nil {
-		fmt.Printf("searchFields handler failed: %s\n", err.Error())
+		fmt.Printf("shipsWithinPolygon handler failed: %s\n", err.Error())
 	}
 }
 
-func shipMeta(w http.ResponseWriter, _ *http.Request) {
-	shipmeta := ShipMetadata{
-		ShipType:  ShipTypes,
-		ShipGroup: ShipTypeGroups,
-		NavStatus: NavStatus,
+func shipsWithinRadius(w http.ResponseWriter, r *http.Request, d *Dock) {
+	centre, err := parseLatLon(r.PathValue("centre"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	radiusNm, err := strconv.ParseFloat(r.PathValue("nm"), 64)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	ships, err := d.Ships.GetShipsInRadius(centre, radiusNm)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Printf("shipsWithinRadius handler failed: %s\n", err.Error())
+		return
 	}
 
+	res := d.Ships.DeadReckon(ships, d.DeadReckoning)
+
 	w.Header().Set("Content-Type", "application/json")
-	err := json.NewEncoder(w).Encode(shipmeta)
+	err = json.NewEncoder(w).Encode(res)
 	if err != nil {
-		fmt.Printf("shipMeta handler failed: %s\n", err.Error())
+		fmt.Printf("shipsWithinRadius handler failed: %s\n", err.Error())
 	}
 }
 
-func generateBbox(sw []string, ne []string) ([2][2]float64, error) {
-	bbox := [2][2]float64{}
-	var err error
+func shipsNearest(w http.ResponseWriter, r *http.Request, d *Dock) {
+	centre, err := parseLatLon(r.PathValue("centre"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
 
-	bbox[0][0], err = strconv.ParseFloat(sw[0], 64)
+	k, err := nearestK(r)
 	if err != nil {
-		return bbox, err
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Printf("shipsNearest handler failed: %s\n", err.Error())
+		return
 	}
 
-	bbox[0][1], err = strconv.ParseFloat(sw[1], 64)
+	res, err := d.Ships.GetNearestShips(centre, k, 0)
 	if err != nil {
-		return bbox, err
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Printf("shipsNearest handler failed: %s\n", err.Error())
+		return
 	}
 
-	bbox[1][0], err = strconv.ParseFloat(ne[0], 64)
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(res)
 	if err != nil {
-		return bbox, err
+		fmt.Printf("shipsNearest handler failed: %s\n", err.Error())
 	}
+}
 
-	bbox[1][1], err = strconv.ParseFloat(ne[1], 64)
+func shipNearest(w http.ResponseWriter, r *http.Request, d *Dock) {
+	mmsi, err := strconv.Atoi(r.PathValue("mmsi"))
 	if err != nil {
-		return bbox, err
+		w.WriteHeader(http.StatusNotFound)
+		return
 	}
 
-	return bbox, nil
+	k, err := nearestK(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Printf("shipNearest handler failed: %s\n", err.Error())
+		return
+	}
+
+	res, err := d.Ships.GetShipNearest(mmsi, k)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Printf("shipNearest handler failed: %s\n", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(res)
+	if err != nil {
+		fmt.Printf("shipNearest handler failed: %s\n", err.Error())
+	}
+}
+
+func shipEncounters(w http.ResponseWriter, r *http.Request, d *Dock) {
+	mmsiStr := r.PathValue("mmsi")
+	if mmsiStr == "" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	mmsi, err := strconv.Atoi(mmsiStr)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	res, err := d.Ships.GetShipEncounters(mmsi, d.Encounter)
+	if err != nil {
+		fmt.Printf("shipEncounters handler failed: %s\n", err.Error())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(res)
+	if err != nil {
+		fmt.Printf("shipEncounters handler failed: %s\n", err.Error())
+	}
+}
+
+func encountersBbox(w http.ResponseWriter, r *http.Request, d *Dock) {
+	sw := strings.Split(r.PathValue("sw"), ",")
+	ne := strings.Split(r.PathValue("ne"), ",")
+
+	if len(sw) != 2 || len(ne) != 2 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	bbox, err := generateBbox(sw, ne)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Printf("encountersBbox handler failed: %s\n", err.Error())
+		return
+	}
+
+	res, err := d.Ships.GetEncountersInBox(bbox, d.Encounter)
+	if errors.Is(err, errEncounterLimit) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Printf("encountersBbox handler failed: %s\n", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(res)
+	if err != nil {
+		fmt.Printf("encountersBbox handler failed: %s\n", err.Error())
+	}
+}
+
+func areaHistoryBbox(w http.ResponseWriter, r *http.Request, d *Dock) {
+	sw := strings.Split(r.PathValue("sw"), ",")
+	ne := strings.Split(r.PathValue("ne"), ",")
+
+	if len(sw) != 2 || len(ne) != 2 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	bbox, err := generateBbox(sw, ne)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Printf("areaHistoryBbox handler failed: %s\n", err.Error())
+		return
+	}
+
+	areaHistory(w, r, d, bboxPolygon(bbox), "areaHistoryBbox")
+}
+
+func areaHistoryPolygon(w http.ResponseWriter, r *http.Request, d *Dock) {
+	polygon, err := decodeGeoJSONPolygon(w, r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Printf("areaHistoryPolygon handler failed: %s\n", err.Error())
+		return
+	}
+
+	areaHistory(w, r, d, polygon, "areaHistoryPolygon")
+}
+
+// areaHistory responds with the visits to polygon within the requested time range, defaulting to the last AREA_DEFAULT_HOURS.
+func areaHistory(w http.ResponseWriter, r *http.Request, d *Dock, polygon [][]float64, name string) {
+	from, to, ranged, err := timeRange(r, d.Tracks.RetainDays)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if !ranged {
+		to = time.Now().Unix()
+		from = to - AREA_DEFAULT_HOURS*3600
+	}
+
+	res, err := d.Ships.GetAreaVisits(polygon, from, to, d.TrackStore)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Printf("%s handler failed: %s\n", name, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(res)
+	if err != nil {
+		fmt.Printf("%s handler failed: %s\n", name, err.Error())
+	}
+}
+
+// playback streams stored positions as newline delimited json at speed times real time.
+// Ships are selected with a comma separated mmsi list or an sw and ne bounding box, over the from and to time range.
+// The stream's session id is returned in the X-Playback-Session header for use with playbackControl.
+func playback(w http.ResponseWriter, r *http.Request, d *Dock) {
+	q := r.URL.Query()
+
+	var mmsis []int
+	if mmsiStr := q.Get("mmsi"); mmsiStr != "" {
+		for _, m := range strings.Split(mmsiStr, ",") {
+			mmsi, err := strconv.Atoi(m)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			mmsis = append(mmsis, mmsi)
+		}
+	}
+
+	var bbox *[2][2]float64
+	if q.Get("sw") != "" || q.Get("ne") != "" {
+		sw := strings.Split(q.Get("sw"), ",")
+		ne := strings.Split(q.Get("ne"), ",")
+		if len(sw) != 2 || len(ne) != 2 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		b, err := generateBbox(sw, ne)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		bbox = &b
+	}
+
+	from, to, ranged, err := timeRange(r, d.Tracks.RetainDays)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if !ranged {
+		to = time.Now().Unix()
+		from = to - AREA_DEFAULT_HOURS*3600
+	}
+
+	speed := float64(PLAYBACK_DEFAULT_SPEED)
+	if speedStr := q.Get("speed"); speedStr != "" {
+		speed, err = playbackSpeed(speedStr)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	frames, err := d.GetPlaybackFrames(mmsis, bbox, from, to)
+	if errors.Is(err, errPlaybackLimit) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Printf("playback handler failed: %s\n", err.Error())
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	pb, err := d.Playbacks.NewPlayback(frames, from, to, speed)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Printf("playback handler failed: %s\n", err.Error())
+		return
+	}
+	defer d.Playbacks.Remove(pb.ID)
+
+	if seekStr := q.Get("seek"); seekStr != "" {
+		seek, err := strconv.ParseInt(seekStr, 10, 64)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		pb.SeekTo(seek)
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("X-Playback-Session", pb.ID)
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	enc := json.NewEncoder(w)
+	ticker := time.NewTicker(PLAYBACK_TICK_MS * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			due, more := pb.Advance(PLAYBACK_TICK_MS)
+			for _, frame := range due {
+				err = enc.Encode(frame)
+				if err != nil {
+					fmt.Printf("playback handler failed: %s\n", err.Error())
+					return
+				}
+			}
+			flusher.Flush()
+
+			if !more {
+				return
+			}
+		}
+	}
+}
+
+// playbackControl pauses, resumes, seeks or changes the speed of an open playback stream.
+// Accepts pause=true|false, seek as a unix timestamp and speed as query params.
+func playbackControl(w http.ResponseWriter, r *http.Request, d *Dock) {
+	pb, ok := d.Playbacks.Get(r.PathValue("id"))
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	q := r.URL.Query()
+
+	if pauseStr := q.Get("pause"); pauseStr != "" {
+		pause, err := strconv.ParseBool(pauseStr)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		pb.SetPaused(pause)
+	}
+
+	if seekStr := q.Get("seek"); seekStr != "" {
+		seek, err := strconv.ParseInt(seekStr, 10, 64)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		pb.SeekTo(seek)
+	}
+
+	if speedStr := q.Get("speed"); speedStr != "" {
+		speed, err := playbackSpeed(speedStr)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		pb.SetSpeed(speed)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func shipsByDestination(w http.ResponseWriter, r *http.Request, d *Dock) {
+	locode := r.PathValue("locode")
+	if locode == "" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	res := d.Ships.GetShipsByDestination(locode)
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(res)
+	if err != nil {
+		fmt.Printf("shipsByDestination handler failed: %s\n", err.Error())
+	}
+}
+
+func searchFields(w http.ResponseWriter, _ *http.Request, d *Dock) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(d.Cache.Search.List)
+	if err != nil {
+		fmt.Printf("searchFields handler failed: %s\n", err.Error())
+	}
+}
+
+func live(w http.ResponseWriter, r *http.Request, d *Dock) {
+	conn, err := websocket.Accept(w, r, nil)
+	if err != nil {
+		fmt.Printf("live handler failed: %s\n", err.Error())
+		return
+	}
+	defer conn.CloseNow()
+
+	err = NewLiveClient(conn, d).Run(r.Context())
+	if err != nil && websocket.CloseStatus(err) == -1 && !errors.Is(err, context.Canceled) {
+		fmt.Printf("live handler failed: %s\n", err.Error())
+	}
+}
+
+// events streams fleet events as Server-Sent Events, filtered by the optional type and mmsi lists and sw, ne area.
+func events(w http.ResponseWriter, r *http.Request, d *Dock) {
+	q := r.URL.Query()
+
+	var f EventFilter
+	if typeStr := q.Get("type"); typeStr != "" {
+		f.Types = map[string]bool{}
+		for _, t := range strings.Split(typeStr, ",") {
+			f.Types[strings.TrimSpace(t)] = true
+		}
+	}
+
+	var err error
+	f.MMSIs, err = intSet(q.Get("mmsi"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if q.Get("sw") != "" || q.Get("ne") != "" {
+		sw := strings.Split(q.Get("sw"), ",")
+		ne := strings.Split(q.Get("ne"), ",")
+		if len(sw) != 2 || len(ne) != 2 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		bbox, err := generateBbox(sw, ne)
+		if err != nil || !validBbox(bbox) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.Bbox = &bbox
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	c := d.Events.Subscribe(f)
+	defer d.Events.Unsubscribe(c)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepalive := time.NewTicker(EVENT_KEEPALIVE_SECONDS * time.Second)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepalive.C:
+			_, err = fmt.Fprint(w, ": keepalive\n\n")
+		case e := <-c:
+			var b []byte
+			b, err = json.Marshal(e)
+			if err != nil {
+				fmt.Printf("events handler failed: %s\n", err.Error())
+				continue
+			}
+			_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, b)
+		}
+
+		if err != nil {
+			fmt.Printf("events handler failed: %s\n", err.Error())
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// shipsTile responds with the ships in a tile as a Mapbox Vector Tile, y may carry the .mvt suffix.
+func shipsTile(w http.ResponseWriter, r *http.Request, d *Dock) {
+	z, err := strconv.Atoi(r.PathValue("z"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	x, err := strconv.Atoi(r.PathValue("x"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	y, err := strconv.Atoi(strings.TrimSuffix(r.PathValue("y"), ".mvt"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	filter, err := shipFilter(r.URL.Query())
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Printf("shipsTile handler failed: %s\n", err.Error())
+		return
+	}
+
+	tile, err := d.Ships.GetShipsTile(z, x, y, filter)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Printf("shipsTile handler failed: %s\n", err.Error())
+		return
+	}
+
+	// Tiles are fetched by map libraries hosted on other origins.
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", MVT_MEDIA_TYPE)
+	w.Header().Set("Content-Length", strconv.Itoa(len(tile)))
+	_, err = w.Write(tile)
+	if err != nil {
+		fmt.Printf("shipsTile handler failed: %s\n", err.Error())
+	}
+}
+
+func anomalies(w http.ResponseWriter, _ *http.Request, d *Dock) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(d.Ships.GetAnomalies())
+	if err != nil {
+		fmt.Printf("anomalies handler failed: %s\n", err.Error())
+	}
+}
+
+func shipMeta(w http.ResponseWriter, _ *http.Request) {
+	shipmeta := ShipMetadata{
+		ShipType:  ShipTypes,
+		ShipGroup: ShipTypeGroups,
+		NavStatus: NavStatus,
+		Flag:      MIDFlags,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(shipmeta)
+	if err != nil {
+		fmt.Printf("shipMeta handler failed: %s\n", err.Error())
+	}
+}
+
+func generateBbox(sw []string, ne []string) ([2][2]float64, error) {
+	bbox := [2][2]float64{}
+	var err error
+
+	bbox[0][0], err = strconv.ParseFloat(sw[0], 64)
+	if err != nil {
+		return bbox, err
+	}
+
+	bbox[0][1], err = strconv.ParseFloat(sw[1], 64)
+	if err != nil {
+		return bbox, err
+	}
+
+	bbox[1][0], err = strconv.ParseFloat(ne[0], 64)
+	if err != nil {
+		return bbox, err
+	}
+
+	bbox[1][1], err = strconv.ParseFloat(ne[1], 64)
+	if err != nil {
+		return bbox, err
+	}
+
+	return bbox, nil
+}
+
+func writeShipsBinary(w http.ResponseWriter, b []byte) error {
+	w.Header().Set("Content-Type", SHIPS_BINARY_MEDIA_TYPE)
+	w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+	_, err := w.Write(b)
+	return err
+}
+
+// nearestK parses the k query parameter, defaulting to NEAREST_DEFAULT_K and capped at NEAREST_MAX_K.
+func nearestK(r *http.Request) (int, error) {
+	kStr := r.URL.Query().Get("k")
+	if kStr == "" {
+		return NEAREST_DEFAULT_K, nil
+	}
+
+	k, err := strconv.Atoi(kStr)
+	if err != nil || k < 1 {
+		return 0, fmt.Errorf("invalid k %q", kStr)
+	}
+
+	return min(k, NEAREST_MAX_K), nil
+}
+
+// parseLatLon parses a comma separated lat, lon pair.
+func parseLatLon(latLonStr string) ([]float64, error) {
+	parts := strings.Split(latLonStr, ",")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("could not parse lat, lon from %s", latLonStr)
+	}
+
+	lat, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return nil, err
+	}
+
+	lon, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil {
+		return nil, err
+	}
+
+	return []float64{lat, lon}, nil
+}
+
+// timeRange parses the optional from and to query params as unix timestamps.
+// A missing to defaults to now and a missing from defaults to retainDays before to.
+// Returns false if neither param was given.
+func timeRange(r *http.Request, retainDays int) (int64, int64, bool, error) {
+	fromStr := r.URL.Query().Get("from")
+	toStr := r.URL.Query().Get("to")
+	if fromStr == "" && toStr == "" {
+		return 0, 0, false, nil
+	}
+
+	to := time.Now().Unix()
+	if toStr != "" {
+		t, err := strconv.ParseInt(toStr, 10, 64)
+		if err != nil {
+			return 0, 0, false, fmt.Errorf("could not parse to: %w", err)
+		}
+		to = t
+	}
+
+	// Nothing is stored after now, so clamp to rather than walking days that cannot hold positions.
+	to = min(to, time.Now().Unix())
+
+	from := to - int64(retainDays)*86400
+	if fromStr != "" {
+		f, err := strconv.ParseInt(fromStr, 10, 64)
+		if err != nil {
+			return 0, 0, false, fmt.Errorf("could not parse from: %w", err)
+		}
+		from = f
+	}
+
+	// Days before the retention window have been pruned, so clamp from rather than walking them.
+	from = max(from, trackRetainFrom(retainDays))
+
+	if to < from {
+		return 0, 0, false, fmt.Errorf("to is before from or the retention window")
+	}
+
+	return from, to, true, nil
+}
+
+// GeoJSON is the subset of a GeoJSON Feature or Polygon geometry used for area queries.
+type GeoJSON struct {
+	Type        string        `json:"type"`
+	Geometry    *GeoJSON      `json:"geometry"`
+	Coordinates [][][]float64 `json:"coordinates"`
+}
+
+// decodeGeoJSONPolygon reads a GeoJSON Polygon, or a Feature holding one, from the request body.
+// Returns the outer ring as lat, lon vertices, holes are ignored.
+func decodeGeoJSONPolygon(w http.ResponseWriter, r *http.Request) ([][]float64, error) {
+	var g GeoJSON
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&g)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode geojson: %w", err)
+	}
+
+	if g.Type == "Feature" && g.Geometry != nil {
+		g = *g.Geometry
+	}
+
+	if g.Type != "Polygon" || len(g.Coordinates) == 0 {
+		return nil, fmt.Errorf("geojson must be a Polygon or a Feature with Polygon geometry")
+	}
+
+	polygon := make([][]float64, 0, len(g.Coordinates[0]))
+	for _, c := range g.Coordinates[0] {
+		if len(c) < 2 {
+			return nil, fmt.Errorf("geojson position must have longitude and latitude")
+		}
+		// GeoJSON positions are longitude then latitude.
+		polygon = append(polygon, []float64{c[1], c[0]})
+	}
+
+	return polygon, nil
+}
+
+func playbackSpeed(speedStr string) (float64, error) {
+	speed, err := strconv.ParseFloat(speedStr, 64)
+	if err != nil {
+		return 0, fmt.Errorf("could not parse speed: %w", err)
+	}
+
+	if speed <= 0 || speed > PLAYBACK_MAX_SPEED {
+		return 0, fmt.Errorf("speed must be greater than 0 and at most %d", PLAYBACK_MAX_SPEED)
+	}
+
+	return speed, nil
+}
+
+// trackOptions parses the optional interval (seconds), tolerance (meters) and maxPoints query params.
+func trackOptions(r *http.Request) (TrackOptions, error) {
+	var opts TrackOptions
+	var err error
+	q := r.URL.Query()
+
+	if intervalStr := q.Get("interval"); intervalStr != "" {
+		opts.Interval, err = strconv.ParseInt(intervalStr, 10, 64)
+		if err != nil || opts.Interval < 0 {
+			return opts, fmt.Errorf("could not parse interval")
+		}
+		if opts.Interval > 0 && opts.Interval < RESAMPLE_MIN_INTERVAL_S {
+			return opts, fmt.Errorf("interval must be at least %d seconds", RESAMPLE_MIN_INTERVAL_S)
+		}
+	}
+
+	if toleranceStr := q.Get("tolerance"); toleranceStr != "" {
+		opts.Tolerance, err = strconv.ParseFloat(toleranceStr, 64)
+		if err != nil || opts.Tolerance < 0 {
+			return opts, fmt.Errorf("could not parse tolerance")
+		}
+	}
+
+	if maxPointsStr := q.Get("maxPoints"); maxPointsStr != "" {
+		opts.MaxPoints, err = strconv.Atoi(maxPointsStr)
+		if err != nil || opts.MaxPoints < 0 {
+			return opts, fmt.Errorf("could not parse maxPoints")
+		}
+	}
+
+	return opts, nil
+}
+
+// shipFilter parses the attribute filters of a ships query, also used by live subscriptions.
+// group, type, navStatus and flag take comma separated lists, minSpeed and maxSpeed are knots, maxAge is seconds since the last update
+// and named=true or named=false keeps only ships with or without a name.
+func shipFilter(q url.Values) (ShipFilter, error) {
+	var f ShipFilter
+	var err error
+
+	f.Groups, err = intSet(q.Get("group"))
+	if err != nil {
+		return f, fmt.Errorf("could not parse group: %w", err)
+	}
+
+	f.Types, err = intSet(q.Get("type"))
+	if err != nil {
+		return f, fmt.Errorf("could not parse type: %w", err)
+	}
+
+	f.NavStatus, err = intSet(q.Get("navStatus"))
+	if err != nil {
+		return f, fmt.Errorf("could not parse navStatus: %w", err)
+	}
+
+	if flagStr := q.Get("flag"); flagStr != "" {
+		f.Flags = map[string]bool{}
+		for _, flag := range strings.Split(flagStr, ",") {
+			f.Flags[strings.ToUpper(strings.TrimSpace(flag))] = true
+		}
+	}
+
+	if minStr := q.Get("minSpeed"); minStr != "" {
+		f.MinSOG, err = strconv.ParseFloat(minStr, 64)
+		if err != nil || f.MinSOG < 0 {
+			return f, fmt.Errorf("could not parse minSpeed")
+		}
+	}
+
+	if maxStr := q.Get("maxSpeed"); maxStr != "" {
+		f.MaxSOG, err = strconv.ParseFloat(maxStr, 64)
+		if err != nil || f.MaxSOG < 0 {
+			return f, fmt.Errorf("could not parse maxSpeed")
+		}
+	}
+
+	if ageStr := q.Get("maxAge"); ageStr != "" {
+		f.MaxAgeSeconds, err = strconv.ParseInt(ageStr, 10, 64)
+		if err != nil || f.MaxAgeSeconds < 0 {
+			return f, fmt.Errorf("could not parse maxAge")
+		}
+	}
+
+	if namedStr := q.Get("named"); namedStr != "" {
+		named, err := strconv.ParseBool(namedStr)
+		if err != nil {
+			return f, fmt.Errorf("could not parse named")
+		}
+		f.Named = &named
+	}
+
+	return f, nil
+}
+
+// intSet parses a comma separated list of integers, returning nil for an empty list.
+func intSet(list string) (map[int]bool, error) {
+	if list == "" {
+		return nil, nil
+	}
+
+	set := map[int]bool{}
+	for _, v := range strings.Split(list, ",") {
+		i, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil {
+			return nil, err
+		}
+		set[i] = true
+	}
+
+	return set, nil
 }
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestTimeRange(t *testing.T) {
+	now := time.Now().Unix()
+	retainFrom := trackRetainFrom(3)
+
+	tests := []struct {
+		name       string
+		query      string
+		wantFrom   int64
+		wantTo     int64
+		wantRanged bool
+		wantErr    bool
+	}{
+		{name: "no range", query: ""},
+		{name: "within retention", query: fmt.Sprintf("?from=%d&to=%d", now-3600, now-60), wantFrom: now - 3600, wantTo: now - 60, wantRanged: true},
+		{name: "from before retention", query: fmt.Sprintf("?from=0&to=%d", now-60), wantFrom: retainFrom, wantTo: now - 60, wantRanged: true},
+		{name: "far future to", query: fmt.Sprintf("?from=%d&to=9000000000000", now-3600), wantFrom: now - 3600, wantTo: now, wantRanged: true},
+		{name: "future from", query: fmt.Sprintf("?from=%d", now+3600), wantErr: true},
+		{name: "to before from", query: fmt.Sprintf("?from=%d&to=%d", now-60, now-3600), wantErr: true},
+		{name: "unparsable", query: "?to=tomorrow", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, to, ranged, err := timeRange(httptest.NewRequest("GET", "/shipHistory/1"+tt.query, nil), 3)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("timeRange(%q) error = %v, want error %v", tt.query, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			// to defaults to and is clamped to the current time, allow for the clock moving on during the test.
+			if from != tt.wantFrom || to < tt.wantTo || to > tt.wantTo+1 || ranged != tt.wantRanged {
+				t.Errorf("timeRange(%q) = %d, %d, %v, want %d, %d, %v", tt.query, from, to, ranged, tt.wantFrom, tt.wantTo, tt.wantRanged)
+			}
+		})
+	}
+}
+
+func TestShipHistoryRangeInMemory(t *testing.T) {
+	const mmsi = 244000001
+	now := time.Now().Unix()
+
+	d := &Dock{Ships: newTestShips(map[int][]float64{mmsi: {51.9, 4.1}})}
+	d.Ships.History[mmsi] = NewHistoryBufferFrom([]History{
+		NewHistory([]float64{51.9, 4.1}, now-60),
+		NewHistory([]float64{51.8, 4.0}, now-3600),
+		NewHistory([]float64{51.7, 3.9}, now-7200),
+	})
+
+	tests := []struct {
+		name  string
+		query string
+		want  []int64
+	}{
+		{name: "no range", query: "", want: []int64{now - 60, now - 3600, now - 7200}},
+		{name: "from", query: fmt.Sprintf("?from=%d", now-3600), want: []int64{now - 60, now - 3600}},
+		{name: "from and to", query: fmt.Sprintf("?from=%d&to=%d", now-7200, now-3600), want: []int64{now - 3600, now - 7200}},
+		{name: "empty range", query: fmt.Sprintf("?from=%d&to=%d", now-600, now-300), want: []int64{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", fmt.Sprintf("/shipHistory/%d%s", mmsi, tt.query), nil)
+			r.SetPathValue("mmsi", strconv.Itoa(mmsi))
+			w := httptest.NewRecorder()
+
+			shipHistory(w, r, d)
+
+			var res []History
+			err := json.NewDecoder(w.Body).Decode(&res)
+			if err != nil {
+				t.Fatalf("could not decode response: %s", err.Error())
+			}
+
+			got := []int64{}
+			for _, h := range res {
+				got = append(got, h.Timestamp)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("shipHistory%s = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
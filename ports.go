@@ -0,0 +1,219 @@
+package main
+
+// Port describes a seaport in the bundled UN/LOCODE port list.
+// Aliases hold common alternate spellings and abbreviations observed in AIS destination fields.
+type Port struct {
+	Name    string    `json:"name"`
+	LatLon  []float64 `json:"latlon"`
+	Aliases []string  `json:"aliases,omitempty"`
+}
+
+// Ports maps UN/LOCODEs to a curated list of major commercial ports.
+// Coordinates are approximate port centres and are intended for distance estimation only.
+// Reference: https://unece.org/trade/cefact/unlocode-code-list-country-and-territory
+var Ports = map[string]Port{
+	"NLRTM": {Name: "Rotterdam", LatLon: []float64{51.95, 4.14}, Aliases: []string{"EUROPOORT", "MAASVLAKTE", "ROTTERDAM ANCH"}},
+	"NLAMS": {Name: "Amsterdam", LatLon: []float64{52.38, 4.90}, Aliases: []string{"IJMUIDEN"}},
+	"NLVLI": {Name: "Vlissingen", LatLon: []float64{51.44, 3.60}, Aliases: []string{"FLUSHING"}},
+	"BEANR": {Name: "Antwerp", LatLon: []float64{51.26, 4.40}, Aliases: []string{"ANTWERPEN", "ANVERS"}},
+	"BEZEE": {Name: "Zeebrugge", LatLon: []float64{51.33, 3.20}},
+	"DEHAM": {Name: "Hamburg", LatLon: []float64{53.54, 9.97}},
+	"DEBRV": {Name: "Bremerhaven", LatLon: []float64{53.55, 8.58}, Aliases: []string{"BREMERHAFEN"}},
+	"DEWVN": {Name: "Wilhelmshaven", LatLon: []float64{53.52, 8.15}},
+	"FRLEH": {Name: "Le Havre", LatLon: []float64{49.48, 0.11}, Aliases: []string{"HAVRE"}},
+	"FRFOS": {Name: "Fos-sur-Mer", LatLon: []float64{43.43, 4.90}, Aliases: []string{"FOS"}},
+	"FRMRS": {Name: "Marseille", LatLon: []float64{43.33, 5.33}, Aliases: []string{"MARSEILLES"}},
+	"FRDKK": {Name: "Dunkerque", LatLon: []float64{51.05, 2.37}, Aliases: []string{"DUNKIRK"}},
+	"GBFXT": {Name: "Felixstowe", LatLon: []float64{51.95, 1.32}},
+	"GBSOU": {Name: "Southampton", LatLon: []float64{50.90, -1.40}},
+	"GBLGP": {Name: "London Gateway", LatLon: []float64{51.50, 0.47}},
+	"GBLON": {Name: "London", LatLon: []float64{51.50, 0.05}},
+	"GBLIV": {Name: "Liverpool", LatLon: []float64{53.45, -3.02}},
+	"GBIMM": {Name: "Immingham", LatLon: []float64{53.63, -0.19}},
+	"IEDUB": {Name: "Dublin", LatLon: []float64{53.35, -6.20}},
+	"ISREY": {Name: "Reykjavik", LatLon: []float64{64.15, -21.94}},
+	"ESALG": {Name: "Algeciras", LatLon: []float64{36.13, -5.43}},
+	"ESVLC": {Name: "Valencia", LatLon: []float64{39.44, -0.32}},
+	"ESBCN": {Name: "Barcelona", LatLon: []float64{41.35, 2.16}},
+	"PTSIE": {Name: "Sines", LatLon: []float64{37.95, -8.87}},
+	"PTLIS": {Name: "Lisbon", LatLon: []float64{38.70, -9.15}, Aliases: []string{"LISBOA"}},
+	"GIGIB": {Name: "Gibraltar", LatLon: []float64{36.14, -5.36}},
+	"MAPTM": {Name: "Tanger Med", LatLon: []float64{35.89, -5.50}, Aliases: []string{"TANGIER", "TANGER"}},
+	"ITGOA": {Name: "Genoa", LatLon: []float64{44.40, 8.92}, Aliases: []string{"GENOVA"}},
+	"ITSPE": {Name: "La Spezia", LatLon: []float64{44.10, 9.84}, Aliases: []string{"SPEZIA"}},
+	"ITGIT": {Name: "Gioia Tauro", LatLon: []float64{38.44, 15.90}},
+	"ITTRS": {Name: "Trieste", LatLon: []float64{45.64, 13.76}},
+	"MTMAR": {Name: "Marsaxlokk", LatLon: []float64{35.82, 14.54}, Aliases: []string{"MALTA FREEPORT"}},
+	"SIKOP": {Name: "Koper", LatLon: []float64{45.55, 13.73}},
+	"HRRJK": {Name: "Rijeka", LatLon: []float64{45.33, 14.43}},
+	"GRPIR": {Name: "Piraeus", LatLon: []float64{37.94, 23.62}, Aliases: []string{"PIREAUS"}},
+	"TRIST": {Name: "Istanbul", LatLon: []float64{41.01, 28.97}},
+	"TRAMB": {Name: "Ambarli", LatLon: []float64{40.97, 28.68}},
+	"TRMER": {Name: "Mersin", LatLon: []float64{36.79, 34.64}},
+	"CYLMS": {Name: "Limassol", LatLon: []float64{34.65, 33.02}},
+	"ILHFA": {Name: "Haifa", LatLon: []float64{32.82, 35.00}},
+	"ILASH": {Name: "Ashdod", LatLon: []float64{31.82, 34.64}},
+	"LBBEY": {Name: "Beirut", LatLon: []float64{33.90, 35.52}},
+	"EGPSD": {Name: "Port Said", LatLon: []float64{31.26, 32.30}},
+	"EGSUZ": {Name: "Suez", LatLon: []float64{29.96, 32.55}},
+	"EGALY": {Name: "Alexandria", LatLon: []float64{31.18, 29.87}},
+	"SEGOT": {Name: "Gothenburg", LatLon: []float64{57.69, 11.90}, Aliases: []string{"GOTEBORG"}},
+	"DKAAR": {Name: "Aarhus", LatLon: []float64{56.15, 10.23}},
+	"DKCPH": {Name: "Copenhagen", LatLon: []float64{55.70, 12.60}, Aliases: []string{"KOBENHAVN"}},
+	"NOOSL": {Name: "Oslo", LatLon: []float64{59.90, 10.74}},
+	"PLGDN": {Name: "Gdansk", LatLon: []float64{54.40, 18.67}},
+	"PLGDY": {Name: "Gdynia", LatLon: []float64{54.53, 18.55}},
+	"FIHEL": {Name: "Helsinki", LatLon: []float64{60.16, 24.95}},
+	"EETLL": {Name: "Tallinn", LatLon: []float64{59.45, 24.77}, Aliases: []string{"MUUGA"}},
+	"LVRIX": {Name: "Riga", LatLon: []float64{56.97, 24.10}},
+	"LTKLJ": {Name: "Klaipeda", LatLon: []float64{55.71, 21.12}},
+	"RULED": {Name: "St Petersburg", LatLon: []float64{59.88, 30.20}, Aliases: []string{"SAINT PETERSBURG", "SPB"}},
+	"RUULU": {Name: "Ust-Luga", LatLon: []float64{59.68, 28.40}},
+	"RUNVS": {Name: "Novorossiysk", LatLon: []float64{44.72, 37.79}},
+	"RUVVO": {Name: "Vladivostok", LatLon: []float64{43.11, 131.88}},
+	"UAODS": {Name: "Odesa", LatLon: []float64{46.49, 30.74}, Aliases: []string{"ODESSA"}},
+	"ROCND": {Name: "Constanta", LatLon: []float64{44.17, 28.66}},
+	"AEJEA": {Name: "Jebel Ali", LatLon: []float64{25.01, 55.06}},
+	"AEDXB": {Name: "Dubai", LatLon: []float64{25.27, 55.28}},
+	"AEKHL": {Name: "Khalifa Port", LatLon: []float64{24.81, 54.65}},
+	"AEAUH": {Name: "Abu Dhabi", LatLon: []float64{24.52, 54.38}},
+	"AEFJR": {Name: "Fujairah", LatLon: []float64{25.17, 56.36}},
+	"OMSLL": {Name: "Salalah", LatLon: []float64{16.94, 54.00}},
+	"OMSOH": {Name: "Sohar", LatLon: []float64{24.50, 56.62}},
+	"SAJED": {Name: "Jeddah", LatLon: []float64{21.46, 39.17}, Aliases: []string{"JEDDAH ISLAMIC PORT"}},
+	"SADMM": {Name: "Dammam", LatLon: []float64{26.50, 50.20}},
+	"SARTA": {Name: "Ras Tanura", LatLon: []float64{26.64, 50.16}},
+	"QAHMD": {Name: "Hamad", LatLon: []float64{25.00, 51.60}},
+	"QARLF": {Name: "Ras Laffan", LatLon: []float64{25.92, 51.55}},
+	"KWKWI": {Name: "Kuwait", LatLon: []float64{29.37, 47.98}, Aliases: []string{"SHUWAIKH"}},
+	"IQUQR": {Name: "Umm Qasr", LatLon: []float64{30.03, 47.95}},
+	"IRBND": {Name: "Bandar Abbas", LatLon: []float64{27.14, 56.21}},
+	"PKKHI": {Name: "Karachi", LatLon: []float64{24.84, 66.98}},
+	"INNSA": {Name: "Nhava Sheva", LatLon: []float64{18.95, 72.95}, Aliases: []string{"JNPT", "NHAVASHEVA", "JAWAHARLAL NEHRU"}},
+	"INBOM": {Name: "Mumbai", LatLon: []float64{18.95, 72.85}, Aliases: []string{"BOMBAY"}},
+	"INMUN": {Name: "Mundra", LatLon: []float64{22.74, 69.70}},
+	"INMAA": {Name: "Chennai", LatLon: []float64{13.10, 80.30}, Aliases: []string{"MADRAS"}},
+	"INCOK": {Name: "Cochin", LatLon: []float64{9.97, 76.26}, Aliases: []string{"KOCHI"}},
+	"INVTZ": {Name: "Visakhapatnam", LatLon: []float64{17.69, 83.29}, Aliases: []string{"VIZAG"}},
+	"LKCMB": {Name: "Colombo", LatLon: []float64{6.95, 79.85}},
+	"BDCGP": {Name: "Chittagong", LatLon: []float64{22.30, 91.80}, Aliases: []string{"CHATTOGRAM"}},
+	"MMRGN": {Name: "Yangon", LatLon: []float64{16.77, 96.17}, Aliases: []string{"RANGOON"}},
+	"SGSIN": {Name: "Singapore", LatLon: []float64{1.26, 103.84}, Aliases: []string{"SPORE", "S PORE", "SINGAPORE EOPL"}},
+	"MYPKG": {Name: "Port Klang", LatLon: []float64{3.00, 101.39}, Aliases: []string{"KLANG"}},
+	"MYTPP": {Name: "Tanjung Pelepas", LatLon: []float64{1.36, 103.55}, Aliases: []string{"PTP"}},
+	"MYPEN": {Name: "Penang", LatLon: []float64{5.41, 100.35}},
+	"IDTPP": {Name: "Tanjung Priok", LatLon: []float64{-6.10, 106.88}, Aliases: []string{"JAKARTA"}},
+	"IDSUB": {Name: "Surabaya", LatLon: []float64{-7.20, 112.73}},
+	"THLCH": {Name: "Laem Chabang", LatLon: []float64{13.08, 100.88}},
+	"THBKK": {Name: "Bangkok", LatLon: []float64{13.70, 100.57}},
+	"VNSGN": {Name: "Ho Chi Minh", LatLon: []float64{10.77, 106.71}, Aliases: []string{"SAIGON", "HCMC", "HOCHIMINH"}},
+	"VNCMT": {Name: "Cai Mep", LatLon: []float64{10.55, 107.03}},
+	"VNHPH": {Name: "Haiphong", LatLon: []float64{20.86, 106.68}, Aliases: []string{"HAI PHONG"}},
+	"PHMNL": {Name: "Manila", LatLon: []float64{14.60, 120.96}},
+	"HKHKG": {Name: "Hong Kong", LatLon: []float64{22.30, 114.17}, Aliases: []string{"HK"}},
+	"CNSHA": {Name: "Shanghai", LatLon: []float64{31.23, 121.49}, Aliases: []string{"YANGSHAN", "WAIGAOQIAO"}},
+	"CNNGB": {Name: "Ningbo", LatLon: []float64{29.87, 121.88}, Aliases: []string{"NINGBO ZHOUSHAN", "BEILUN"}},
+	"CNZOS": {Name: "Zhoushan", LatLon: []float64{30.00, 122.10}},
+	"CNSZX": {Name: "Shenzhen", LatLon: []float64{22.50, 113.88}, Aliases: []string{"SHEKOU", "CHIWAN"}},
+	"CNYTN": {Name: "Yantian", LatLon: []float64{22.57, 114.27}},
+	"CNCAN": {Name: "Guangzhou", LatLon: []float64{22.80, 113.60}, Aliases: []string{"NANSHA"}},
+	"CNTAO": {Name: "Qingdao", LatLon: []float64{36.07, 120.32}, Aliases: []string{"TSINGTAO"}},
+	"CNTXG": {Name: "Tianjin", LatLon: []float64{38.98, 117.75}, Aliases: []string{"XINGANG", "TIANJIN XINGANG"}},
+	"CNDLC": {Name: "Dalian", LatLon: []float64{38.93, 121.65}},
+	"CNXMN": {Name: "Xiamen", LatLon: []float64{24.45, 118.07}, Aliases: []string{"AMOY"}},
+	"CNLYG": {Name: "Lianyungang", LatLon: []float64{34.74, 119.45}},
+	"CNRZH": {Name: "Rizhao", LatLon: []float64{35.38, 119.55}},
+	"CNFOC": {Name: "Fuzhou", LatLon: []float64{26.00, 119.45}},
+	"TWKHH": {Name: "Kaohsiung", LatLon: []float64{22.61, 120.28}},
+	"TWKEL": {Name: "Keelung", LatLon: []float64{25.15, 121.74}},
+	"TWTXG": {Name: "Taichung", LatLon: []float64{24.28, 120.51}},
+	"KRPUS": {Name: "Busan", LatLon: []float64{35.10, 129.04}, Aliases: []string{"PUSAN"}},
+	"KRINC": {Name: "Incheon", LatLon: []float64{37.45, 126.60}, Aliases: []string{"INCHON"}},
+	"KRKAN": {Name: "Gwangyang", LatLon: []float64{34.91, 127.70}, Aliases: []string{"KWANGYANG"}},
+	"KRUSN": {Name: "Ulsan", LatLon: []float64{35.50, 129.38}},
+	"JPTYO": {Name: "Tokyo", LatLon: []float64{35.62, 139.78}},
+	"JPYOK": {Name: "Yokohama", LatLon: []float64{35.45, 139.65}},
+	"JPNGO": {Name: "Nagoya", LatLon: []float64{35.05, 136.88}},
+	"JPOSA": {Name: "Osaka", LatLon: []float64{34.64, 135.43}},
+	"JPUKB": {Name: "Kobe", LatLon: []float64{34.68, 135.20}},
+	"JPCHB": {Name: "Chiba", LatLon: []float64{35.57, 140.08}},
+	"JPHKT": {Name: "Hakata", LatLon: []float64{33.61, 130.40}, Aliases: []string{"FUKUOKA"}},
+	"AUSYD": {Name: "Sydney", LatLon: []float64{-33.97, 151.22}, Aliases: []string{"BOTANY BAY", "PORT BOTANY"}},
+	"AUMEL": {Name: "Melbourne", LatLon: []float64{-37.84, 144.92}},
+	"AUBNE": {Name: "Brisbane", LatLon: []float64{-27.38, 153.17}},
+	"AUFRE": {Name: "Fremantle", LatLon: []float64{-32.05, 115.74}, Aliases: []string{"PERTH"}},
+	"AUPHE": {Name: "Port Hedland", LatLon: []float64{-20.31, 118.58}},
+	"AUDAM": {Name: "Dampier", LatLon: []float64{-20.66, 116.71}},
+	"AUNTL": {Name: "Newcastle", LatLon: []float64{-32.92, 151.79}},
+	"AUGLT": {Name: "Gladstone", LatLon: []float64{-23.83, 151.25}},
+	"NZAKL": {Name: "Auckland", LatLon: []float64{-36.84, 174.77}},
+	"NZTRG": {Name: "Tauranga", LatLon: []float64{-37.65, 176.18}},
+	"FJSUV": {Name: "Suva", LatLon: []float64{-18.13, 178.42}},
+	"FJLTK": {Name: "Lautoka", LatLon: []float64{-17.60, 177.44}},
+	"PGPOM": {Name: "Port Moresby", LatLon: []float64{-9.47, 147.15}},
+	"USLAX": {Name: "Los Angeles", LatLon: []float64{33.73, -118.26}, Aliases: []string{"LA", "SAN PEDRO"}},
+	"USLGB": {Name: "Long Beach", LatLon: []float64{33.75, -118.22}},
+	"USOAK": {Name: "Oakland", LatLon: []float64{37.80, -122.30}},
+	"USSEA": {Name: "Seattle", LatLon: []float64{47.60, -122.34}},
+	"USTIW": {Name: "Tacoma", LatLon: []float64{47.27, -122.41}},
+	"USPDX": {Name: "Portland", LatLon: []float64{45.60, -122.70}},
+	"USNYC": {Name: "New York", LatLon: []float64{40.67, -74.05}, Aliases: []string{"NY", "NYC", "NEWARK", "NY NJ"}},
+	"USSAV": {Name: "Savannah", LatLon: []float64{32.08, -81.09}},
+	"USORF": {Name: "Norfolk", LatLon: []float64{36.90, -76.33}},
+	"USCHS": {Name: "Charleston", LatLon: []float64{32.78, -79.92}},
+	"USHOU": {Name: "Houston", LatLon: []float64{29.73, -95.27}},
+	"USMSY": {Name: "New Orleans", LatLon: []float64{29.95, -90.06}, Aliases: []string{"NOLA"}},
+	"USBAL": {Name: "Baltimore", LatLon: []float64{39.26, -76.58}},
+	"USPHL": {Name: "Philadelphia", LatLon: []float64{39.90, -75.13}},
+	"USBOS": {Name: "Boston", LatLon: []float64{42.35, -71.04}},
+	"USJAX": {Name: "Jacksonville", LatLon: []float64{30.40, -81.55}},
+	"USMIA": {Name: "Miami", LatLon: []float64{25.77, -80.17}},
+	"USPEF": {Name: "Port Everglades", LatLon: []float64{26.09, -80.12}},
+	"USMOB": {Name: "Mobile", LatLon: []float64{30.69, -88.04}},
+	"USCRP": {Name: "Corpus Christi", LatLon: []float64{27.81, -97.40}},
+	"USANC": {Name: "Anchorage", LatLon: []float64{61.22, -149.89}},
+	"USDUT": {Name: "Dutch Harbor", LatLon: []float64{53.89, -166.54}, Aliases: []string{"UNALASKA"}},
+	"USHNL": {Name: "Honolulu", LatLon: []float64{21.31, -157.87}},
+	"CAVAN": {Name: "Vancouver", LatLon: []float64{49.29, -123.10}},
+	"CAPRR": {Name: "Prince Rupert", LatLon: []float64{54.31, -130.33}},
+	"CAMTR": {Name: "Montreal", LatLon: []float64{45.55, -73.52}},
+	"CAHAL": {Name: "Halifax", LatLon: []float64{44.64, -63.56}},
+	"MXZLO": {Name: "Manzanillo", LatLon: []float64{19.05, -104.31}},
+	"MXLZC": {Name: "Lazaro Cardenas", LatLon: []float64{17.94, -102.18}},
+	"MXVER": {Name: "Veracruz", LatLon: []float64{19.20, -96.13}},
+	"PABLB": {Name: "Balboa", LatLon: []float64{8.95, -79.57}},
+	"PAONX": {Name: "Colon", LatLon: []float64{9.36, -79.90}, Aliases: []string{"CRISTOBAL", "MANZANILLO PANAMA"}},
+	"CUHAV": {Name: "Havana", LatLon: []float64{23.14, -82.35}},
+	"JMKIN": {Name: "Kingston", LatLon: []float64{17.97, -76.80}},
+	"BSFPO": {Name: "Freeport", LatLon: []float64{26.52, -78.77}},
+	"COCTG": {Name: "Cartagena", LatLon: []float64{10.39, -75.53}},
+	"COBUN": {Name: "Buenaventura", LatLon: []float64{3.89, -77.07}},
+	"ECGYE": {Name: "Guayaquil", LatLon: []float64{-2.28, -79.91}},
+	"PECLL": {Name: "Callao", LatLon: []float64{-12.05, -77.15}},
+	"CLSAI": {Name: "San Antonio", LatLon: []float64{-33.59, -71.62}},
+	"CLVAP": {Name: "Valparaiso", LatLon: []float64{-33.03, -71.63}},
+	"BRSSZ": {Name: "Santos", LatLon: []float64{-23.98, -46.30}},
+	"BRPNG": {Name: "Paranagua", LatLon: []float64{-25.50, -48.52}},
+	"BRRIG": {Name: "Rio Grande", LatLon: []float64{-32.07, -52.09}},
+	"BRRIO": {Name: "Rio de Janeiro", LatLon: []float64{-22.89, -43.18}},
+	"BRITJ": {Name: "Itajai", LatLon: []float64{-26.90, -48.65}},
+	"ARBUE": {Name: "Buenos Aires", LatLon: []float64{-34.60, -58.37}},
+	"UYMVD": {Name: "Montevideo", LatLon: []float64{-34.90, -56.21}},
+	"ZADUR": {Name: "Durban", LatLon: []float64{-29.87, 31.03}},
+	"ZACPT": {Name: "Cape Town", LatLon: []float64{-33.91, 18.43}},
+	"ZAZBA": {Name: "Ngqura", LatLon: []float64{-33.80, 25.68}, Aliases: []string{"COEGA"}},
+	"ZAPLZ": {Name: "Port Elizabeth", LatLon: []float64{-33.96, 25.63}, Aliases: []string{"GQEBERHA"}},
+	"NAWVB": {Name: "Walvis Bay", LatLon: []float64{-22.95, 14.50}},
+	"MZMPM": {Name: "Maputo", LatLon: []float64{-25.97, 32.57}},
+	"TZDAR": {Name: "Dar es Salaam", LatLon: []float64{-6.83, 39.29}},
+	"KEMBA": {Name: "Mombasa", LatLon: []float64{-4.06, 39.66}},
+	"DJJIB": {Name: "Djibouti", LatLon: []float64{11.60, 43.13}},
+	"MUPLU": {Name: "Port Louis", LatLon: []float64{-20.15, 57.49}},
+	"NGAPP": {Name: "Apapa", LatLon: []float64{6.44, 3.39}, Aliases: []string{"LAGOS"}},
+	"GHTEM": {Name: "Tema", LatLon: []float64{5.63, 0.01}},
+	"CIABJ": {Name: "Abidjan", LatLon: []float64{5.28, -4.01}},
+	"TGLFW": {Name: "Lome", LatLon: []float64{6.13, 1.28}},
+	"SNDKR": {Name: "Dakar", LatLon: []float64{14.68, -17.43}},
+	"AOLAD": {Name: "Luanda", LatLon: []float64{-8.79, 13.23}},
+	"CGPNR": {Name: "Pointe Noire", LatLon: []float64{-4.78, 11.83}},
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/bbailey1024/geohash"
+)
+
+const ROUTE_MAX_TURN = 90.0
+
+// Route configures the traffic graph used for route prediction.
+// Tracks are reduced to transitions between geohash cells of Bits precision and the graph is rebuilt every Timer minutes.
+type Route struct {
+	Enable   bool `json:"enable"`
+	Timer    int  `json:"timer"`
+	Bits     int  `json:"bits"`
+	Hours    int  `json:"hours"`
+	MaxHours int  `json:"maxHours"`
+}
+
+// Lanes is a traffic graph of observed transitions between geohash cells.
+// Edges are weighted by the number of ship tracks that made the transition.
+type Lanes struct {
+	Route      Route
+	Lock       sync.RWMutex
+	Edges      map[uint64]map[uint64]int
+	LastUpdate int64
+	Quit       chan struct{}
+	Done       chan struct{}
+}
+
+// RoutePoint is a predicted position and the time the ship is expected to reach it.
+type RoutePoint struct {
+	LatLon    []float64 `json:"latlon"`
+	Timestamp int64     `json:"timestamp"`
+}
+
+func NewRouteDefaults() Route {
+	return Route{
+		Enable:   true,
+		Timer:    30,
+		Bits:     20,
+		Hours:    6,
+		MaxHours: 48,
+	}
+}
+
+func NewLanes(r Route) *Lanes {
+	return &Lanes{
+		Route: r,
+		Edges: map[uint64]map[uint64]int{},
+		Quit:  make(chan struct{}),
+		Done:  make(chan struct{}),
+	}
+}
+
+func (l *Lanes) Run(s *Ships) {
+	if !l.Route.Enable || l.Route.Timer < 1 {
+		<-l.Quit
+		l.Done <- struct{}{}
+		return
+	}
+
+	l.Generate(s)
+
+	ticker := time.NewTicker(time.Duration(l.Route.Timer) * time.Minute)
+
+	for {
+		select {
+		case <-ticker.C:
+			l.Generate(s)
+		case <-l.Quit:
+			l.Done <- struct{}{}
+			return
+		}
+	}
+}
+
+// Generate rebuilds the traffic graph from the history of every ship.
+func (l *Lanes) Generate(s *Ships) {
+	edges := map[uint64]map[uint64]int{}
+
+	// Copy the histories and release the lock before encoding cells, so dock workers are not blocked for the whole build.
+	s.HistoryLock.RLock()
+	histories := make([][]History, 0, len(s.History))
+	for _, buffer := range s.History {
+		histories = append(histories, buffer.Points())
+	}
+	s.HistoryLock.RUnlock()
+
+	for _, history := range histories {
+		// History is newest first, walk it oldest first so edges follow the direction of travel.
+		for i := len(history) - 1; i > 0; i-- {
+			from := l.cell(history[i].LatLon)
+			to := l.cell(history[i-1].LatLon)
+			if from == to {
+				continue
+			}
+
+			if _, ok := edges[from]; !ok {
+				edges[from] = map[uint64]int{}
+			}
+			edges[from][to]++
+		}
+	}
+
+	l.Lock.Lock()
+	l.Edges = edges
+	l.LastUpdate = time.Now().Unix()
+	l.Lock.Unlock()
+}
+
+func (l *Lanes) cell(latLon []float64) uint64 {
+	return geohash.EncodeIntPrecision(latLon[0], latLon[1], l.Route.Bits)
+}
+
+func (l *Lanes) centre(cell uint64) []float64 {
+	lat, lon := geohash.DecodeIntPrecision(cell, l.Route.Bits)
+
+	// DecodeIntPrecision returns the south west corner of the cell, offset by half a cell to its centre.
+	latBits := l.Route.Bits / 2
+	lonBits := l.Route.Bits - latBits
+	lat += 90 / math.Exp2(float64(latBits))
+	lon += 180 / math.Exp2(float64(lonBits))
+
+	return []float64{lat, lon}
+}
+
+// PredictRoute follows the busiest lanes leaving the ship's current cell for the given number of hours at the ship's speed.
+// Only lanes within ROUTE_MAX_TURN degrees of the current course are followed.
+// Once no lane is available, the route continues along the last course until the time budget is spent.
+// Ships without an available speed or course get an empty route.
+func (s *Ships) PredictRoute(mmsi int, hours int, l *Lanes) ([]RoutePoint, error) {
+	s.StateLock.RLock()
+	ship, ok := s.State[mmsi]
+	var state State
+	if ok {
+		state = *ship
+	}
+	s.StateLock.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("mmsi does not exist in ship state")
+	}
+
+	if hours < 1 {
+		hours = l.Route.Hours
+	}
+	hours = min(hours, l.Route.MaxHours)
+
+	route := make([]RoutePoint, 0)
+	if len(state.LatLon) != 2 || state.SOG <= MOVING_SPEED_THRESHOLD || state.SOG >= SOG_NOT_AVAILABLE || state.COG >= COG_NOT_AVAILABLE {
+		return route, nil
+	}
+
+	now := time.Now().Unix()
+	position := state.LatLon
+	course := state.COG
+	remaining := state.SOG * float64(hours)
+	elapsed := 0.0
+
+	route = append(route, RoutePoint{LatLon: position, Timestamp: now})
+
+	l.Lock.RLock()
+	defer l.Lock.RUnlock()
+
+	visited := map[uint64]bool{l.cell(position): true}
+	current := l.cell(position)
+
+	for remaining > 0 {
+		next, ok := l.nextCell(current, position, course, visited)
+		if !ok {
+			break
+		}
+
+		target := l.centre(next)
+		dist := distanceNm(position, target)
+		if dist > remaining {
+			target = destination(position, bearing(position, target), remaining)
+			dist = remaining
+		}
+
+		course = bearing(position, target)
+		elapsed += dist / state.SOG
+		remaining -= dist
+		position = target
+		current = next
+		visited[next] = true
+
+		route = append(route, RoutePoint{LatLon: position, Timestamp: now + int64(elapsed*3600)})
+	}
+
+	if remaining > 0 {
+		position = destination(position, course, remaining)
+		elapsed += remaining / state.SOG
+		route = append(route, RoutePoint{LatLon: position, Timestamp: now + int64(elapsed*3600)})
+	}
+
+	return route, nil
+}
+
+// nextCell returns the unvisited neighbour with the most traffic that does not require turning more than ROUTE_MAX_TURN degrees.
+func (l *Lanes) nextCell(current uint64, position []float64, course float64, visited map[uint64]bool) (uint64, bool) {
+	candidates := make([]uint64, 0, len(l.Edges[current]))
+	for cell := range l.Edges[current] {
+		if !visited[cell] {
+			candidates = append(candidates, cell)
+		}
+	}
+
+	// Sort for deterministic tie breaking.
+	slices.Sort(candidates)
+
+	var best uint64
+	bestScore := 0.0
+	for _, cell := range candidates {
+		turn := angleDiff(course, bearing(position, l.centre(cell)))
+		if turn > ROUTE_MAX_TURN {
+			continue
+		}
+
+		score := float64(l.Edges[current][cell]) * math.Cos(radians(turn))
+		if score > bestScore {
+			best = cell
+			bestScore = score
+		}
+	}
+
+	return best, bestScore > 0
+}
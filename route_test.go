@@ -0,0 +1,126 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// laneHistory returns positions every 0.4 degrees of longitude along latitude 50 from lon to lon+steps*0.4, ordered newest first.
+func laneHistory(lon float64, steps int, east bool) []History {
+	history := []History{}
+	for i := 0; i <= steps; i++ {
+		point := []float64{50, lon + float64(i)*0.4}
+		if !east {
+			point = []float64{50, lon + float64(steps-i)*0.4}
+		}
+		history = append([]History{NewHistory(point, int64(i)*3600)}, history...)
+	}
+	return history
+}
+
+func TestLanesGenerate(t *testing.T) {
+	s := newTestShips(map[int][]float64{1: {50, 0}, 2: {50, 0}, 3: {50, 0}, 4: {50, 0}})
+	s.History[1] = NewHistoryBufferFrom(laneHistory(0, 2, true))
+	s.History[2] = NewHistoryBufferFrom(laneHistory(0, 2, true))
+	s.History[3] = NewHistoryBufferFrom(laneHistory(0, 2, false))
+	s.History[4] = NewHistoryBufferFrom([]History{NewHistory([]float64{50, 0.01}, 1), NewHistory([]float64{50, 0}, 0)})
+
+	l := NewLanes(NewRouteDefaults())
+	l.Generate(s)
+
+	a := l.cell([]float64{50, 0})
+	b := l.cell([]float64{50, 0.4})
+	c := l.cell([]float64{50, 0.8})
+
+	tests := []struct {
+		name     string
+		from, to uint64
+		want     int
+	}{
+		{name: "shared lane", from: a, to: b, want: 2},
+		{name: "shared lane onward", from: b, to: c, want: 2},
+		{name: "opposite direction", from: c, to: b, want: 1},
+		{name: "skipped cell", from: a, to: c, want: 0},
+		{name: "within a cell", from: a, to: a, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := l.Edges[tt.from][tt.to]; got != tt.want {
+				t.Errorf("Edges[%d][%d] = %d, want %d", tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+
+	if l.LastUpdate == 0 {
+		t.Errorf("LastUpdate not set")
+	}
+}
+
+func TestPredictRoute(t *testing.T) {
+	const mmsi = 244000001
+
+	tests := []struct {
+		name      string
+		sog, cog  float64
+		wantLane  bool
+		wantEmpty bool
+	}{
+		{name: "follows lane", sog: 10, cog: 90, wantLane: true},
+		{name: "against lane", sog: 10, cog: 270},
+		{name: "stationary", sog: 0, cog: 90, wantEmpty: true},
+		{name: "speed not available", sog: SOG_NOT_AVAILABLE, cog: 90, wantEmpty: true},
+		{name: "course not available", sog: 10, cog: COG_NOT_AVAILABLE, wantEmpty: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestShips(map[int][]float64{1: {50, 0}, mmsi: {50, 0}})
+			s.History[1] = NewHistoryBufferFrom(laneHistory(0, 10, true))
+			s.State[mmsi].SOG = tt.sog
+			s.State[mmsi].COG = tt.cog
+
+			l := NewLanes(NewRouteDefaults())
+			l.Generate(s)
+
+			start := time.Now().Unix()
+			route, err := s.PredictRoute(mmsi, 6, l)
+			if err != nil {
+				t.Fatalf("PredictRoute failed: %s", err.Error())
+			}
+
+			if tt.wantEmpty {
+				if len(route) != 0 {
+					t.Errorf("PredictRoute() = %v, want no route", route)
+				}
+				return
+			}
+
+			if len(route) < 2 {
+				t.Fatalf("PredictRoute() = %v, want a route", route)
+			}
+
+			// Six hours at ten knots, the time budget is spent whether or not lanes are followed.
+			end := route[len(route)-1]
+			if math.Abs(float64(end.Timestamp-start-6*3600)) > 2 {
+				t.Errorf("route ends at %d, want %d", end.Timestamp, start+6*3600)
+			}
+
+			lane := 0
+			for _, p := range route[1:] {
+				if centre := l.centre(l.cell(p.LatLon)); distanceNm(p.LatLon, centre) < 1e-6 {
+					lane++
+				}
+			}
+
+			if tt.wantLane && lane < 3 {
+				t.Errorf("route %v follows %d lane cells, want at least 3", route, lane)
+			}
+
+			if !tt.wantLane && (lane != 0 || len(route) != 2) {
+				t.Errorf("route %v follows %d lane cells, want a straight line", route, lane)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"slices"
+)
+
+const (
+	SIMPLIFY_MIN_TOLERANCE_M = 1.0
+	RESAMPLE_MIN_INTERVAL_S  = 10
+	RESAMPLE_MAX_POINTS      = 100000
+)
+
+// TrackOptions reduces a history response to suit the client's zoom level.
+// Interval resamples the track to one point every Interval seconds, Tolerance simplifies it with Douglas-Peucker to within Tolerance meters,
+// and MaxPoints caps the number of points returned. Zero values disable each step, which are applied in that order.
+// Interval must be at least RESAMPLE_MIN_INTERVAL_S and resampling may produce at most RESAMPLE_MAX_POINTS points.
+type TrackOptions struct {
+	Interval  int64
+	Tolerance float64
+	MaxPoints int
+}
+
+// Apply returns a reduced copy of history, which is ordered newest first like GetShipHistory.
+func (o TrackOptions) Apply(history []History) ([]History, error) {
+	track := slices.Clone(history)
+	slices.Reverse(track)
+
+	if o.Interval > 0 {
+		var err error
+		track, err = resampleTrack(track, o.Interval)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if o.Tolerance > 0 {
+		track = simplifyTrack(track, o.Tolerance)
+	}
+
+	if o.MaxPoints > 0 {
+		track = capTrack(track, o.MaxPoints)
+	}
+
+	slices.Reverse(track)
+
+	return track, nil
+}
+
+// resampleTrack interpolates a track, ordered oldest first, at fixed intervals from its first point.
+// The last point is always kept so the track ends at the latest known position.
+// Returns an error if interval is below RESAMPLE_MIN_INTERVAL_S or the track would exceed RESAMPLE_MAX_POINTS points.
+func resampleTrack(track []History, interval int64) ([]History, error) {
+	if interval < RESAMPLE_MIN_INTERVAL_S {
+		return nil, fmt.Errorf("interval must be at least %d seconds", RESAMPLE_MIN_INTERVAL_S)
+	}
+
+	if len(track) < 2 {
+		return track, nil
+	}
+
+	if (track[len(track)-1].Timestamp-track[0].Timestamp)/interval+1 > RESAMPLE_MAX_POINTS {
+		return nil, fmt.Errorf("interval would resample the track to more than %d points", RESAMPLE_MAX_POINTS)
+	}
+
+	resampled := []History{}
+	i := 0
+	for t := track[0].Timestamp; t < track[len(track)-1].Timestamp; t += interval {
+		for track[i+1].Timestamp < t {
+			i++
+		}
+		resampled = append(resampled, NewHistory(interpolate(track[i], track[i+1], t), t))
+	}
+
+	return append(resampled, track[len(track)-1]), nil
+}
+
+// interpolate returns the position at time t on the straight line between a and b.
+func interpolate(a History, b History, t int64) []float64 {
+	if b.Timestamp == a.Timestamp {
+		return a.LatLon
+	}
+
+	f := float64(t-a.Timestamp) / float64(b.Timestamp-a.Timestamp)
+
+	// Take the short way round when the ship crossed the antimeridian.
+	dLon := math.Mod(b.LatLon[1]-a.LatLon[1]+540, 360) - 180
+	return []float64{
+		a.LatLon[0] + (b.LatLon[0]-a.LatLon[0])*f,
+		math.Mod(a.LatLon[1]+dLon*f+540, 360) - 180,
+	}
+}
+
+// simplifyTrack applies Douglas-Peucker to a track, keeping only points further than tolerance meters from the simplified line.
+func simplifyTrack(track []History, tolerance float64) []History {
+	if len(track) < 3 {
+		return track
+	}
+
+	keep := make([]bool, len(track))
+	keep[0] = true
+	keep[len(track)-1] = true
+
+	// Walk segments with an explicit stack as long tracks would recurse deeply.
+	stack := [][2]int{{0, len(track) - 1}}
+	for len(stack) > 0 {
+		seg := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		furthest := -1
+		furthestDist := 0.0
+		for i := seg[0] + 1; i < seg[1]; i++ {
+			d := crossTrackMeters(track[i].LatLon, track[seg[0]].LatLon, track[seg[1]].LatLon)
+			if d > furthestDist {
+				furthest = i
+				furthestDist = d
+			}
+		}
+
+		if furthest > 0 && furthestDist > tolerance {
+			keep[furthest] = true
+			stack = append(stack, [2]int{seg[0], furthest}, [2]int{furthest, seg[1]})
+		}
+	}
+
+	simplified := []History{}
+	for i, h := range track {
+		if keep[i] {
+			simplified = append(simplified, h)
+		}
+	}
+
+	return simplified
+}
+
+// capTrack reduces a track to at most maxPoints by simplifying with a doubling tolerance.
+// If doubling the tolerance overshoots to fewer than half of maxPoints, points of the last simplification that was too long are dropped evenly instead.
+func capTrack(track []History, maxPoints int) []History {
+	if len(track) <= maxPoints {
+		return track
+	}
+
+	for tolerance := SIMPLIFY_MIN_TOLERANCE_M; tolerance < EARTH_RADIUS_NM*METERS_IN_NM; tolerance *= 2 {
+		simplified := simplifyTrack(track, tolerance)
+		if len(simplified) <= maxPoints {
+			if len(simplified) >= maxPoints/2 {
+				return simplified
+			}
+			break
+		}
+		track = simplified
+	}
+
+	// Dropping points evenly keeps the first and last, keep only the latest if fewer are allowed.
+	if maxPoints < 2 {
+		return track[len(track)-maxPoints:]
+	}
+
+	capped := make([]History, 0, maxPoints)
+	step := float64(len(track)-1) / float64(maxPoints-1)
+	for i := 0; i < maxPoints; i++ {
+		capped = append(capped, track[int(math.Round(float64(i)*step))])
+	}
+
+	return capped
+}
+
+// crossTrackMeters returns the distance in meters from p to the segment a, b on a local flat projection centred on a.
+func crossTrackMeters(p []float64, a []float64, b []float64) float64 {
+	project := func(latLon []float64) (float64, float64) {
+		dLon := math.Mod(latLon[1]-a[1]+540, 360) - 180
+		x := dLon * 60 * math.Cos(radians(a[0])) * METERS_IN_NM
+		y := (latLon[0] - a[0]) * 60 * METERS_IN_NM
+		return x, y
+	}
+
+	px, py := project(p)
+	bx, by := project(b)
+
+	lengthSq := bx*bx + by*by
+	if lengthSq == 0 {
+		return math.Hypot(px, py)
+	}
+
+	t := max(0, min(1, (px*bx+py*by)/lengthSq))
+	return math.Hypot(px-t*bx, py-t*by)
+}
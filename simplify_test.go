@@ -0,0 +1,218 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+// testTrack builds a track, ordered oldest first, from lat, lon points one minute apart.
+func testTrack(points ...[]float64) []History {
+	track := make([]History, 0, len(points))
+	for i, p := range points {
+		track = append(track, NewHistory(p, int64(i*60)))
+	}
+	return track
+}
+
+func trackTimestamps(track []History) []int64 {
+	timestamps := []int64{}
+	for _, h := range track {
+		timestamps = append(timestamps, h.Timestamp)
+	}
+	return timestamps
+}
+
+// zigzagTrack alternates between the equator and 0.001 degrees (about 111 meters) north of it every 0.01 degrees of longitude.
+func zigzagTrack(n int, lon float64) []History {
+	points := [][]float64{}
+	for i := range n {
+		points = append(points, []float64{float64(i%2) * 0.001, math.Mod(lon+float64(i)*0.01+540, 360) - 180})
+	}
+	return testTrack(points...)
+}
+
+func TestSimplifyTrack(t *testing.T) {
+	tests := []struct {
+		name      string
+		track     []History
+		tolerance float64
+		want      []int64
+	}{
+		{
+			name:      "straight line",
+			track:     testTrack([]float64{50, 0}, []float64{50, 0.01}, []float64{50, 0.02}, []float64{50, 0.03}),
+			tolerance: 10,
+			want:      []int64{0, 180},
+		},
+		{
+			name:      "wiggle within tolerance",
+			track:     testTrack([]float64{50, 0}, []float64{50.00005, 0.01}, []float64{49.99995, 0.02}, []float64{50, 0.03}),
+			tolerance: 10,
+			want:      []int64{0, 180},
+		},
+		{
+			name:      "corner",
+			track:     testTrack([]float64{50, 0}, []float64{50, 0.01}, []float64{50, 0.02}, []float64{50.01, 0.02}, []float64{50.02, 0.02}),
+			tolerance: 10,
+			want:      []int64{0, 120, 240},
+		},
+		{
+			name:      "zigzag above tolerance",
+			track:     zigzagTrack(5, 0),
+			tolerance: 50,
+			want:      []int64{0, 60, 120, 180, 240},
+		},
+		{
+			name:      "zigzag below tolerance",
+			track:     zigzagTrack(5, 0),
+			tolerance: 120,
+			want:      []int64{0, 240},
+		},
+		{
+			name:      "across the antimeridian",
+			track:     testTrack([]float64{0, 179.98}, []float64{0, 179.99}, []float64{0, -179.99}, []float64{0, -179.98}),
+			tolerance: 10,
+			want:      []int64{0, 180},
+		},
+		{
+			name:      "corner across the antimeridian",
+			track:     testTrack([]float64{0, 179.98}, []float64{0, -180}, []float64{0.02, -180}),
+			tolerance: 10,
+			want:      []int64{0, 60, 120},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := trackTimestamps(simplifyTrack(tt.track, tt.tolerance))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("simplifyTrack(%v) = %v, want %v", tt.tolerance, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResampleTrack(t *testing.T) {
+	tests := []struct {
+		name     string
+		track    []History
+		interval int64
+		want     [][]float64
+		wantErr  bool
+	}{
+		{
+			name:     "between points",
+			track:    []History{NewHistory([]float64{50, 0}, 0), NewHistory([]float64{50.2, 0.2}, 100), NewHistory([]float64{50.2, 0.4}, 200)},
+			interval: 50,
+			want:     [][]float64{{50, 0}, {50.1, 0.1}, {50.2, 0.2}, {50.2, 0.3}, {50.2, 0.4}},
+		},
+		{
+			name:     "last point kept",
+			track:    []History{NewHistory([]float64{50, 0}, 0), NewHistory([]float64{50.1, 0}, 70)},
+			interval: 30,
+			want:     [][]float64{{50, 0}, {50 + 0.1*30.0/70, 0}, {50 + 0.1*60.0/70, 0}, {50.1, 0}},
+		},
+		{
+			name:     "across the antimeridian",
+			track:    []History{NewHistory([]float64{0, 179.9}, 0), NewHistory([]float64{0.4, -179.9}, 200)},
+			interval: 50,
+			want:     [][]float64{{0, 179.9}, {0.1, 179.95}, {0.2, 180}, {0.3, -179.95}, {0.4, -179.9}},
+		},
+		{
+			name:     "single point",
+			track:    []History{NewHistory([]float64{50, 0}, 0)},
+			interval: 60,
+			want:     [][]float64{{50, 0}},
+		},
+		{
+			name:     "interval too short",
+			track:    []History{NewHistory([]float64{50, 0}, 0), NewHistory([]float64{50.1, 0}, 70)},
+			interval: RESAMPLE_MIN_INTERVAL_S - 1,
+			wantErr:  true,
+		},
+		{
+			name:     "too many points",
+			track:    []History{NewHistory([]float64{50, 0}, 0), NewHistory([]float64{50.1, 0}, RESAMPLE_MAX_POINTS*RESAMPLE_MIN_INTERVAL_S)},
+			interval: RESAMPLE_MIN_INTERVAL_S,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resampleTrack(tt.track, tt.interval)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resampleTrack(%d) error = %v, want error %v", tt.interval, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("resampleTrack(%d) = %v, want %v", tt.interval, got, tt.want)
+			}
+
+			for i, h := range got {
+				// 180 and -180 are the same meridian.
+				dLon := math.Mod(h.LatLon[1]-tt.want[i][1]+540, 360) - 180
+				if math.Abs(h.LatLon[0]-tt.want[i][0]) > 1e-9 || math.Abs(dLon) > 1e-9 {
+					t.Errorf("resampleTrack(%d)[%d] = %v, want %v", tt.interval, i, h.LatLon, tt.want[i])
+				}
+				if h.LatLon[1] < -180 || h.LatLon[1] > 180 {
+					t.Errorf("resampleTrack(%d)[%d] longitude %v out of range", tt.interval, i, h.LatLon[1])
+				}
+			}
+		})
+	}
+}
+
+func TestCapTrack(t *testing.T) {
+	tests := []struct {
+		name      string
+		track     []History
+		maxPoints int
+		want      []int64
+	}{
+		{
+			name:      "within limit",
+			track:     zigzagTrack(5, 0),
+			maxPoints: 5,
+			want:      []int64{0, 60, 120, 180, 240},
+		},
+		{
+			name:      "simplified",
+			track:     testTrack([]float64{50, 0}, []float64{50, 0.01}, []float64{50, 0.02}, []float64{50.01, 0.02}, []float64{50.02, 0.02}),
+			maxPoints: 3,
+			want:      []int64{0, 120, 240},
+		},
+		{
+			// The zigzag keeps every point until the tolerance passes its amplitude, then collapses to its two ends.
+			name:      "even drop",
+			track:     zigzagTrack(51, 0),
+			maxPoints: 10,
+			want:      []int64{0, 360, 660, 1020, 1320, 1680, 1980, 2340, 2640, 3000},
+		},
+		{
+			name:      "even drop across the antimeridian",
+			track:     zigzagTrack(51, 179.8),
+			maxPoints: 10,
+			want:      []int64{0, 360, 660, 1020, 1320, 1680, 1980, 2340, 2640, 3000},
+		},
+		{
+			name:      "latest only",
+			track:     zigzagTrack(51, 0),
+			maxPoints: 1,
+			want:      []int64{3000},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := trackTimestamps(capTrack(tt.track, tt.maxPoints))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("capTrack(%d) = %v, want %v", tt.maxPoints, got, tt.want)
+			}
+		})
+	}
+}
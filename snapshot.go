@@ -0,0 +1,295 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	SNAPSHOT_VERSION = 2
+	SNAPSHOT_PREFIX  = "snapshot-"
+	SNAPSHOT_SUFFIX  = ".json.gz"
+)
+
+// Snapshot configures periodic snapshots of ship state, info and history to disk.
+// The newest readable snapshot in Dir is restored on startup and only the newest Retain snapshots are kept.
+type Snapshot struct {
+	Enable   bool   `json:"enable"`
+	Dir      string `json:"dir"`
+	Interval int    `json:"intervalMinutes"`
+	Retain   int    `json:"retain"`
+}
+
+// SnapshotFile is the versioned on disk format of a snapshot.
+// WalSegment is the first write-ahead log segment not covered by the snapshot, added in version 2.
+type SnapshotFile struct {
+	Version    int               `json:"version"`
+	Created    int64             `json:"created"`
+	WalSegment uint64            `json:"walSegment"`
+	Ships      map[int]*ShipDump `json:"ships"`
+}
+
+type Snapshotter struct {
+	Snapshot Snapshot
+	Quit     chan struct{}
+	Done     chan struct{}
+}
+
+func NewSnapshotDefaults() Snapshot {
+	return Snapshot{
+		Enable:   false,
+		Dir:      "./snapshots",
+		Interval: 5,
+		Retain:   3,
+	}
+}
+
+func NewSnapshotter(s Snapshot) *Snapshotter {
+	return &Snapshotter{
+		Snapshot: s,
+		Quit:     make(chan struct{}),
+		Done:     make(chan struct{}),
+	}
+}
+
+// Run writes a snapshot every Interval minutes and a final snapshot on quit.
+// The write-ahead log is rotated before each snapshot and compacted once the snapshot is on disk.
+func (sn *Snapshotter) Run(s *Ships, wal *WriteAheadLog) {
+	if !sn.Snapshot.Enable || sn.Snapshot.Interval < 1 {
+		<-sn.Quit
+		sn.Done <- struct{}{}
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(sn.Snapshot.Interval) * time.Minute)
+
+	for {
+		select {
+		case <-ticker.C:
+			sn.save(s, wal)
+		case <-sn.Quit:
+			sn.save(s, wal)
+			sn.Done <- struct{}{}
+			return
+		}
+	}
+}
+
+func (sn *Snapshotter) save(s *Ships, wal *WriteAheadLog) {
+	segment, err := wal.Rotate()
+	if err != nil {
+		fmt.Printf("snapshot wal rotate failed: %s\n", err.Error())
+		return
+	}
+
+	err = WriteSnapshot(sn.Snapshot.Dir, s, segment)
+	if err != nil {
+		fmt.Printf("snapshot failed: %s\n", err.Error())
+		return
+	}
+
+	err = pruneSnapshots(sn.Snapshot.Dir, sn.Snapshot.Retain)
+	if err != nil {
+		fmt.Printf("snapshot prune failed: %s\n", err.Error())
+	}
+
+	err = wal.Compact(segment)
+	if err != nil {
+		fmt.Printf("snapshot wal compact failed: %s\n", err.Error())
+	}
+}
+
+// WriteSnapshot atomically writes the current ships to a new snapshot file in dir.
+// The snapshot is written to a temporary file, synced, then renamed into place so a crash never leaves a partial snapshot.
+// walSegment records the first write-ahead log segment to replay on top of this snapshot.
+func WriteSnapshot(dir string, s *Ships, walSegment uint64) error {
+	ships, err := s.GetShipDump()
+	if err != nil {
+		return fmt.Errorf("could not dump ships: %w", err)
+	}
+
+	err = os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return fmt.Errorf("could not create snapshot dir: %w", err)
+	}
+
+	now := time.Now().UTC()
+	snap := SnapshotFile{
+		Version:    SNAPSHOT_VERSION,
+		Created:    now.Unix(),
+		WalSegment: walSegment,
+		Ships:      ships,
+	}
+
+	tmp, err := os.CreateTemp(dir, SNAPSHOT_PREFIX+"*.tmp")
+	if err != nil {
+		return fmt.Errorf("could not create temporary snapshot: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	gz := gzip.NewWriter(tmp)
+	err = json.NewEncoder(gz).Encode(snap)
+	if err != nil {
+		return fmt.Errorf("could not encode snapshot: %w", err)
+	}
+
+	err = gz.Close()
+	if err != nil {
+		return fmt.Errorf("could not compress snapshot: %w", err)
+	}
+
+	err = tmp.Sync()
+	if err != nil {
+		return fmt.Errorf("could not sync snapshot: %w", err)
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return fmt.Errorf("could not close snapshot: %w", err)
+	}
+
+	name := filepath.Join(dir, fmt.Sprintf("%s%020d%s", SNAPSHOT_PREFIX, now.UnixNano(), SNAPSHOT_SUFFIX))
+	err = os.Rename(tmp.Name(), name)
+	if err != nil {
+		return fmt.Errorf("could not rename snapshot: %w", err)
+	}
+
+	return syncDir(dir)
+}
+
+// LoadSnapshot restores ships from the newest readable snapshot in dir.
+// Unreadable snapshots are skipped in favour of older ones.
+// Returns the first write-ahead log segment that should be replayed on top of the snapshot.
+func LoadSnapshot(dir string) (*Ships, uint64, error) {
+	names, err := listSnapshots(dir)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for i := len(names) - 1; i >= 0; i-- {
+		snap, err := readSnapshot(names[i])
+		if err != nil {
+			fmt.Printf("skipping snapshot %s: %s\n", names[i], err.Error())
+			continue
+		}
+		return snap.restore(), snap.WalSegment, nil
+	}
+
+	return nil, 0, fmt.Errorf("no readable snapshot in %s", dir)
+}
+
+func readSnapshot(name string) (SnapshotFile, error) {
+	var snap SnapshotFile
+
+	f, err := os.Open(name)
+	if err != nil {
+		return snap, fmt.Errorf("could not open file: %w", err)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return snap, fmt.Errorf("could not decompress file: %w", err)
+	}
+	defer gz.Close()
+
+	err = json.NewDecoder(gz).Decode(&snap)
+	if err != nil {
+		return snap, fmt.Errorf("could not decode file: %w", err)
+	}
+
+	// The decoder stops at the end of the json value, read on to the end so gzip verifies the checksum and length in its trailer.
+	_, err = io.Copy(io.Discard, gz)
+	if err != nil {
+		return snap, fmt.Errorf("could not decompress file: %w", err)
+	}
+
+	if snap.Version < 1 || snap.Version > SNAPSHOT_VERSION {
+		return snap, fmt.Errorf("unsupported snapshot version %d", snap.Version)
+	}
+
+	return snap, nil
+}
+
+func (snap SnapshotFile) restore() *Ships {
+	s := NewShips()
+
+	for mmsi, dump := range snap.Ships {
+		state := dump.State
+		info := dump.Info
+		s.State[mmsi] = &state
+		s.Info[mmsi] = &info
+		if len(state.LatLon) == 2 {
+			s.Geo.Update(mmsi, state.LatLon)
+		}
+		s.History[mmsi] = NewHistoryBufferFrom(dump.History)
+	}
+
+	return s
+}
+
+// listSnapshots returns the snapshot files in dir ordered oldest to newest.
+func listSnapshots(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("could not read snapshot dir: %w", err)
+	}
+
+	names := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), SNAPSHOT_PREFIX) || !strings.HasSuffix(entry.Name(), SNAPSHOT_SUFFIX) {
+			continue
+		}
+		names = append(names, filepath.Join(dir, entry.Name()))
+	}
+
+	// Snapshot names embed a zero padded timestamp, so lexical order is chronological.
+	slices.Sort(names)
+
+	return names, nil
+}
+
+func pruneSnapshots(dir string, retain int) error {
+	if retain < 1 {
+		return nil
+	}
+
+	names, err := listSnapshots(dir)
+	if err != nil {
+		return err
+	}
+
+	for len(names) > retain {
+		err = os.Remove(names[0])
+		if err != nil {
+			return fmt.Errorf("could not remove snapshot: %w", err)
+		}
+		names = names[1:]
+	}
+
+	return nil
+}
+
+// syncDir flushes directory entries so a rename survives a crash.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("could not open dir: %w", err)
+	}
+	defer d.Close()
+
+	err = d.Sync()
+	if err != nil {
+		return fmt.Errorf("could not sync dir: %w", err)
+	}
+
+	return nil
+}
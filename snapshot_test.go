@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// writeTestSnapshot writes snap to dir under a name that sorts by seq, returning the file name.
+func writeTestSnapshot(t *testing.T, dir string, seq int, snap SnapshotFile) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	err := json.NewEncoder(gz).Encode(snap)
+	if err != nil {
+		t.Fatalf("could not encode snapshot: %s", err.Error())
+	}
+	err = gz.Close()
+	if err != nil {
+		t.Fatalf("could not compress snapshot: %s", err.Error())
+	}
+
+	name := filepath.Join(dir, fmt.Sprintf("%s%020d%s", SNAPSHOT_PREFIX, seq, SNAPSHOT_SUFFIX))
+	err = os.WriteFile(name, buf.Bytes(), 0o644)
+	if err != nil {
+		t.Fatalf("could not write snapshot: %s", err.Error())
+	}
+
+	return name
+}
+
+func testShipDumps() map[int]*ShipDump {
+	return map[int]*ShipDump{
+		244000001: {
+			State:   State{MMSI: 244000001, Name: "MAAS", LatLon: []float64{51.9, 4.1}, SOG: 12.5, COG: 270, NavStatus: 0, ShipType: 70},
+			Info:    Info{Destination: "NL RTM", DestinationLocode: "NLRTM", IMONumber: 9000001},
+			History: []History{NewHistory([]float64{51.9, 4.1}, 1700000600), NewHistory([]float64{51.9, 4.2}, 1700000000)},
+		},
+		244000002: {
+			State: State{MMSI: 244000002, Name: "SCHELDE"},
+		},
+	}
+}
+
+func assertRestoredShips(t *testing.T, s *Ships, want map[int]*ShipDump) {
+	t.Helper()
+
+	got, err := s.GetShipDump()
+	if err != nil {
+		t.Fatalf("GetShipDump failed: %s", err.Error())
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("restored %d ships, want %d", len(got), len(want))
+	}
+
+	for mmsi, w := range want {
+		g, ok := got[mmsi]
+		if !ok {
+			t.Errorf("ship %d was not restored", mmsi)
+			continue
+		}
+
+		if g.State.Name != w.State.Name || !slices.Equal(g.State.LatLon, w.State.LatLon) || g.State.SOG != w.State.SOG || g.State.COG != w.State.COG || g.State.ShipType != w.State.ShipType {
+			t.Errorf("ship %d state = %+v, want %+v", mmsi, g.State, w.State)
+		}
+
+		if g.Info != w.Info {
+			t.Errorf("ship %d info = %+v, want %+v", mmsi, g.Info, w.Info)
+		}
+
+		if len(g.History) != len(w.History) {
+			t.Errorf("ship %d history = %v, want %v", mmsi, g.History, w.History)
+			continue
+		}
+		for i := range w.History {
+			if g.History[i].Timestamp != w.History[i].Timestamp || !slices.Equal(g.History[i].LatLon, w.History[i].LatLon) {
+				t.Errorf("ship %d history = %v, want %v", mmsi, g.History, w.History)
+				break
+			}
+		}
+	}
+
+	// Ships with a position rejoin the geocache, ships without one are only in state.
+	if got := shipsInBoxMMSIs(t, s, [2][2]float64{{51, 3}, {52, 5}}); !slices.Equal(got, []int{244000001}) {
+		t.Errorf("GetShipsInBox after restore = %v, want [244000001]", got)
+	}
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+
+	s := NewShips()
+	for mmsi, dump := range testShipDumps() {
+		state := dump.State
+		info := dump.Info
+		s.State[mmsi] = &state
+		s.Info[mmsi] = &info
+		if len(state.LatLon) == 2 {
+			s.Geo.Update(mmsi, state.LatLon)
+		}
+		s.History[mmsi] = NewHistoryBufferFrom(dump.History)
+	}
+
+	err := WriteSnapshot(dir, s, 7)
+	if err != nil {
+		t.Fatalf("WriteSnapshot failed: %s", err.Error())
+	}
+
+	restored, segment, err := LoadSnapshot(dir)
+	if err != nil {
+		t.Fatalf("LoadSnapshot failed: %s", err.Error())
+	}
+
+	if segment != 7 {
+		t.Errorf("LoadSnapshot wal segment = %d, want 7", segment)
+	}
+
+	assertRestoredShips(t, restored, testShipDumps())
+}
+
+func TestSnapshotVersion1(t *testing.T) {
+	dir := t.TempDir()
+
+	// Version 1 snapshots predate the write-ahead log and carry no walSegment.
+	writeTestSnapshot(t, dir, 1, SnapshotFile{Version: 1, Created: 1700000000, Ships: testShipDumps()})
+
+	restored, segment, err := LoadSnapshot(dir)
+	if err != nil {
+		t.Fatalf("LoadSnapshot failed: %s", err.Error())
+	}
+
+	if segment != 0 {
+		t.Errorf("LoadSnapshot wal segment = %d, want 0", segment)
+	}
+
+	assertRestoredShips(t, restored, testShipDumps())
+}
+
+func TestReadSnapshotRejectsCorrupt(t *testing.T) {
+	dir := t.TempDir()
+
+	valid := writeTestSnapshot(t, dir, 1, SnapshotFile{Version: SNAPSHOT_VERSION, WalSegment: 3, Ships: testShipDumps()})
+	b, err := os.ReadFile(valid)
+	if err != nil {
+		t.Fatalf("could not read snapshot: %s", err.Error())
+	}
+
+	corrupt := slices.Clone(b)
+	corrupt[len(corrupt)/2] ^= 0xff
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "empty", data: []byte{}},
+		{name: "not gzip", data: []byte(`{"version":2,"ships":{}}`)},
+		{name: "truncated header", data: b[:5]},
+		{name: "truncated", data: b[:len(b)/2]},
+		{name: "missing trailer", data: b[:len(b)-4]},
+		{name: "corrupt", data: corrupt},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := filepath.Join(dir, fmt.Sprintf("%s%020d%s", SNAPSHOT_PREFIX, i+2, SNAPSHOT_SUFFIX))
+			err := os.WriteFile(name, tt.data, 0o644)
+			if err != nil {
+				t.Fatalf("could not write snapshot: %s", err.Error())
+			}
+			defer os.Remove(name)
+
+			_, err = readSnapshot(name)
+			if err == nil {
+				t.Errorf("readSnapshot(%s) succeeded, want error", tt.name)
+			}
+
+			// The newer unreadable snapshot is skipped in favour of the valid one.
+			restored, segment, err := LoadSnapshot(dir)
+			if err != nil {
+				t.Fatalf("LoadSnapshot failed: %s", err.Error())
+			}
+			if segment != 3 || len(restored.State) != len(testShipDumps()) {
+				t.Errorf("LoadSnapshot = %d ships from wal segment %d, want %d ships from wal segment 3", len(restored.State), segment, len(testShipDumps()))
+			}
+		})
+	}
+}
+
+func TestReadSnapshotRejectsVersion(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, version := range []int{0, SNAPSHOT_VERSION + 1} {
+		name := writeTestSnapshot(t, dir, version, SnapshotFile{Version: version, Ships: testShipDumps()})
+
+		_, err := readSnapshot(name)
+		if err == nil {
+			t.Errorf("readSnapshot(version %d) succeeded, want error", version)
+		}
+	}
+}
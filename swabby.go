@@ -1,9 +1,6 @@
 package main
 
-import (
-	"slices"
-	"time"
-)
+import "time"
 
 const SECONDS_IN_DAY = 86400
 
@@ -68,14 +65,8 @@ func (s *Swabby) routeHistory(d *Dock) {
 	now := time.Now().UTC().Unix()
 
 	d.Ships.HistoryLock.Lock()
-	for mmsi, history := range d.Ships.History {
-		for i, h := range history {
-			if now-h.Timestamp > int64(s.ExpiryDays.RouteHistory*SECONDS_IN_DAY) {
-				history = slices.Delete(history, i, len(history))
-				break
-			}
-		}
-		d.Ships.History[mmsi] = history
+	for _, history := range d.Ships.History {
+		history.Expire(now - int64(s.ExpiryDays.RouteHistory*SECONDS_IN_DAY))
 	}
 	d.Ships.HistoryLock.Unlock()
 }
@@ -83,12 +74,16 @@ func (s *Swabby) routeHistory(d *Dock) {
 func (s *Swabby) derelictShips(d *Dock) {
 	now := time.Now().UTC().Unix()
 	derelictShips := []int{}
+	removed := []Event{}
 
 	d.Ships.StateLock.Lock()
 	for mmsi, ship := range d.Ships.State {
 		if now-ship.LastUpdate > int64(s.ExpiryDays.DerelictShip*SECONDS_IN_DAY) {
 			derelictShips = append(derelictShips, mmsi)
+			removed = append(removed, Event{Type: EVENT_SHIP_REMOVED, MMSI: mmsi, Name: ship.Name, LatLon: ship.LatLon, Timestamp: now})
 			delete(d.Ships.State, mmsi)
+			d.Ships.Geo.Remove(mmsi)
+			d.Ships.tombstone(mmsi)
 		}
 	}
 	d.Ships.StateLock.Unlock()
@@ -101,4 +96,12 @@ func (s *Swabby) derelictShips(d *Dock) {
 	}
 	d.Ships.InfoLock.Unlock()
 	d.Ships.HistoryLock.Unlock()
+
+	for _, mmsi := range derelictShips {
+		d.Live.Publish(mmsi)
+	}
+
+	for _, e := range removed {
+		d.Events.Publish(e)
+	}
 }
@@ -0,0 +1,724 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	TRACK_RECORD_BYTES = 20
+	TRACK_SCALE        = 1e7
+	TRACK_DAY_FORMAT   = "2006-01-02"
+	TRACK_SUFFIX       = ".trk"
+	TRACK_INDEX_SUFFIX = ".idx"
+	TRACK_SYNC_SECONDS = 1
+	TRACK_CELL_DEGREES = 1.0
+)
+
+// Tracks configures the on disk track store used for long term ship history.
+// Positions are appended to one segment file per UTC day and segments older than RetainDays are removed.
+type Tracks struct {
+	Enable     bool   `json:"enable"`
+	Dir        string `json:"dir"`
+	RetainDays int    `json:"retainDays"`
+}
+
+// TrackStore is an append-only store of ship positions split into daily segments.
+// Each record is laid out as mmsi (4 bytes), unix timestamp (8 bytes), then latitude and longitude as fixed point int32s (4 bytes each).
+// The index of the current day is held in memory and written alongside the segment when the day rolls over.
+type TrackStore struct {
+	Tracks Tracks
+	Lock   sync.Mutex
+	day    string
+	file   *os.File
+	writer *bufio.Writer
+	index  *trackIndex
+	Quit   chan struct{}
+	Done   chan struct{}
+}
+
+// trackIndex is the spatio-temporal index of a daily segment.
+// Ships maps each mmsi to its record numbers, which are in time order as records are only appended.
+// Cells maps each TRACK_CELL_DEGREES grid cell to the ships with a position in it that day.
+type trackIndex struct {
+	Ships map[int][]uint32
+	Cells map[uint32]map[int]struct{}
+	Last  map[int]int64
+	Count uint32
+}
+
+func NewTracksDefaults() Tracks {
+	return Tracks{
+		Enable:     false,
+		Dir:        "./tracks",
+		RetainDays: 90,
+	}
+}
+
+func NewTrackStore(t Tracks) *TrackStore {
+	return &TrackStore{
+		Tracks: t,
+		index:  newTrackIndex(),
+		Quit:   make(chan struct{}),
+		Done:   make(chan struct{}),
+	}
+}
+
+// Open creates the track directory and opens the segment for the current day.
+func (ts *TrackStore) Open() error {
+	if !ts.Tracks.Enable {
+		return nil
+	}
+
+	err := os.MkdirAll(ts.Tracks.Dir, 0o755)
+	if err != nil {
+		return fmt.Errorf("could not create track dir: %w", err)
+	}
+
+	ts.Lock.Lock()
+	defer ts.Lock.Unlock()
+
+	return ts.openDay(time.Now().UTC().Format(TRACK_DAY_FORMAT))
+}
+
+// Run flushes buffered records every TRACK_SYNC_SECONDS and removes expired segments hourly.
+func (ts *TrackStore) Run() {
+	if !ts.Tracks.Enable {
+		<-ts.Quit
+		ts.Done <- struct{}{}
+		return
+	}
+
+	ts.prune()
+
+	syncTicker := time.NewTicker(TRACK_SYNC_SECONDS * time.Second)
+	pruneTicker := time.NewTicker(time.Hour)
+
+	for {
+		select {
+		case <-syncTicker.C:
+			err := ts.Flush()
+			if err != nil {
+				fmt.Printf("track store flush failed: %s\n", err.Error())
+			}
+		case <-pruneTicker.C:
+			ts.prune()
+		case <-ts.Quit:
+			err := ts.Close()
+			if err != nil {
+				fmt.Printf("track store close failed: %s\n", err.Error())
+			}
+			ts.Done <- struct{}{}
+			return
+		}
+	}
+}
+
+// Append adds a position to the segment of the day it was observed, rolling over to a new segment at midnight UTC.
+// Positions no newer than the last stored for the ship are dropped, so replaying the wal does not store them twice.
+func (ts *TrackStore) Append(mmsi int, latLon []float64, timestamp int64) error {
+	if !ts.Tracks.Enable {
+		return nil
+	}
+
+	ts.Lock.Lock()
+	defer ts.Lock.Unlock()
+
+	day := time.Unix(timestamp, 0).UTC().Format(TRACK_DAY_FORMAT)
+	if day < ts.day || timestamp <= ts.index.Last[mmsi] {
+		return nil
+	}
+
+	if day != ts.day {
+		err := ts.rollover(day)
+		if err != nil {
+			return err
+		}
+	}
+
+	if ts.writer == nil {
+		return fmt.Errorf("track segment is not open")
+	}
+
+	_, err := ts.writer.Write(encodeTrackRecord(mmsi, latLon, timestamp))
+	if err != nil {
+		return fmt.Errorf("could not write track record: %w", err)
+	}
+
+	ts.index.add(mmsi, NewHistory(latLon, timestamp))
+
+	return nil
+}
+
+// Query returns the positions of mmsi observed between from and to inclusive, newest first to match GetShipHistory.
+func (ts *TrackStore) Query(mmsi int, from int64, to int64) ([]History, error) {
+	if !ts.Tracks.Enable {
+		return nil, fmt.Errorf("track store is not enabled")
+	}
+
+	history := make([]History, 0)
+
+	for _, day := range trackDays(from, to, ts.Tracks.RetainDays) {
+		records, err := ts.readDay(day, mmsi)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, r := range records {
+			if r.Timestamp >= from && r.Timestamp <= to {
+				history = append(history, r)
+			}
+		}
+	}
+
+	slices.Reverse(history)
+
+	return history, nil
+}
+
+// QueryArea returns the positions between from and to inclusive of every ship seen in a grid cell overlapping bbox, oldest first.
+// Tracks are only narrowed to the grid cells, callers filter positions to the exact area.
+func (ts *TrackStore) QueryArea(bbox [2][2]float64, from int64, to int64) (map[int][]History, error) {
+	if !ts.Tracks.Enable {
+		return nil, fmt.Errorf("track store is not enabled")
+	}
+
+	cells := trackCellsInBbox(bbox)
+	tracks := map[int][]History{}
+
+	for _, day := range trackDays(from, to, ts.Tracks.RetainDays) {
+		offsets := map[int][]uint32{}
+		err := ts.withIndex(day, func(ti *trackIndex) {
+			for _, cell := range cells {
+				for mmsi := range ti.Cells[cell] {
+					if _, ok := offsets[mmsi]; !ok {
+						offsets[mmsi] = slices.Clone(ti.Ships[mmsi])
+					}
+				}
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for mmsi, o := range offsets {
+			records, err := ts.readRecords(day, o)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, r := range records {
+				if r.Timestamp >= from && r.Timestamp <= to {
+					tracks[mmsi] = append(tracks[mmsi], r)
+				}
+			}
+		}
+	}
+
+	return tracks, nil
+}
+
+func (ts *TrackStore) Flush() error {
+	ts.Lock.Lock()
+	defer ts.Lock.Unlock()
+
+	if ts.writer == nil {
+		return nil
+	}
+
+	return ts.writer.Flush()
+}
+
+func (ts *TrackStore) Close() error {
+	ts.Lock.Lock()
+	defer ts.Lock.Unlock()
+
+	return ts.closeDay()
+}
+
+// readDay returns every record of mmsi in the segment for day in time order.
+func (ts *TrackStore) readDay(day string, mmsi int) ([]History, error) {
+	var offsets []uint32
+	err := ts.withIndex(day, func(ti *trackIndex) {
+		offsets = slices.Clone(ti.Ships[mmsi])
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ts.readRecords(day, offsets)
+}
+
+// readRecords reads the given record numbers from the segment for day.
+func (ts *TrackStore) readRecords(day string, offsets []uint32) ([]History, error) {
+	if len(offsets) == 0 {
+		return nil, nil
+	}
+
+	f, err := os.Open(ts.segmentName(day))
+	if err != nil {
+		return nil, fmt.Errorf("could not open track segment: %w", err)
+	}
+	defer f.Close()
+
+	records := make([]History, 0, len(offsets))
+	b := make([]byte, TRACK_RECORD_BYTES)
+	for _, offset := range offsets {
+		_, err := f.ReadAt(b, int64(offset)*TRACK_RECORD_BYTES)
+		if err != nil {
+			return nil, fmt.Errorf("could not read track record: %w", err)
+		}
+		_, h := decodeTrackRecord(b)
+		records = append(records, h)
+	}
+
+	return records, nil
+}
+
+// withIndex calls fn with the index of day.
+// The current day's index is used under lock after flushing buffered records, so fn must not retain it.
+func (ts *TrackStore) withIndex(day string, fn func(*trackIndex)) error {
+	ts.Lock.Lock()
+	if day == ts.day && ts.writer != nil {
+		defer ts.Lock.Unlock()
+
+		err := ts.writer.Flush()
+		if err != nil {
+			return fmt.Errorf("could not flush track segment: %w", err)
+		}
+
+		fn(ts.index)
+		return nil
+	}
+	ts.Lock.Unlock()
+
+	index, err := ts.loadIndex(day)
+	if err != nil {
+		return err
+	}
+
+	fn(index)
+	return nil
+}
+
+// loadIndex reads the index written for a closed day, falling back to scanning the segment.
+// A missing, unreadable or corrupt index is rebuilt from the segment rather than making the day unreadable.
+func (ts *TrackStore) loadIndex(day string) (*trackIndex, error) {
+	f, err := os.Open(ts.indexName(day))
+	if errors.Is(err, os.ErrNotExist) {
+		return ts.rebuildIndex(day)
+	}
+	if err != nil {
+		fmt.Printf("could not open track index for %s, rebuilding: %s\n", day, err.Error())
+		return ts.rebuildIndex(day)
+	}
+	defer f.Close()
+
+	index, err := readTrackIndex(bufio.NewReader(f))
+	if err != nil {
+		fmt.Printf("could not read track index for %s, rebuilding: %s\n", day, err.Error())
+		return ts.rebuildIndex(day)
+	}
+
+	return index, nil
+}
+
+// rebuildIndex scans the segment for day and writes the index back, so later queries do not scan it again.
+// The index is only written for days before the current one, as their segments no longer change.
+func (ts *TrackStore) rebuildIndex(day string) (*trackIndex, error) {
+	index, err := scanTrackSegment(ts.segmentName(day))
+	if err != nil {
+		return nil, err
+	}
+
+	ts.Lock.Lock()
+	closed := day < ts.day
+	ts.Lock.Unlock()
+
+	_, err = os.Stat(ts.segmentName(day))
+	if !closed || err != nil {
+		return index, nil
+	}
+
+	err = writeTrackIndex(ts.indexName(day), index)
+	if err != nil {
+		fmt.Printf("could not write track index for %s: %s\n", day, err.Error())
+	}
+
+	return index, nil
+}
+
+func (ts *TrackStore) rollover(day string) error {
+	previous := ts.day
+	index := ts.index
+
+	err := ts.closeDay()
+	if err != nil {
+		return err
+	}
+
+	if previous != "" {
+		err = writeTrackIndex(ts.indexName(previous), index)
+		if err != nil {
+			fmt.Printf("could not write track index for %s: %s\n", previous, err.Error())
+		}
+	}
+
+	return ts.openDay(day)
+}
+
+// openDay opens the segment for day, rebuilding its index if the segment already holds records.
+func (ts *TrackStore) openDay(day string) error {
+	index, err := scanTrackSegment(ts.segmentName(day))
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(ts.segmentName(day), os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("could not open track segment: %w", err)
+	}
+
+	// Truncate a partially written trailing record left by a crash.
+	err = f.Truncate(int64(index.Count) * TRACK_RECORD_BYTES)
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("could not truncate track segment: %w", err)
+	}
+
+	_, err = f.Seek(0, io.SeekEnd)
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("could not seek track segment: %w", err)
+	}
+
+	ts.day = day
+	ts.file = f
+	ts.writer = bufio.NewWriter(f)
+	ts.index = index
+
+	return nil
+}
+
+func (ts *TrackStore) closeDay() error {
+	if ts.writer == nil {
+		return nil
+	}
+
+	err := ts.writer.Flush()
+	if err != nil {
+		return fmt.Errorf("could not flush track segment: %w", err)
+	}
+
+	err = ts.file.Close()
+	if err != nil {
+		return fmt.Errorf("could not close track segment: %w", err)
+	}
+
+	ts.file = nil
+	ts.writer = nil
+	ts.index = newTrackIndex()
+
+	return nil
+}
+
+// prune removes segments and indexes for days older than RetainDays.
+func (ts *TrackStore) prune() {
+	if ts.Tracks.RetainDays < 1 {
+		return
+	}
+
+	cutoff := time.Now().UTC().AddDate(0, 0, -ts.Tracks.RetainDays).Format(TRACK_DAY_FORMAT)
+
+	entries, err := os.ReadDir(ts.Tracks.Dir)
+	if err != nil {
+		fmt.Printf("track store prune failed: %s\n", err.Error())
+		return
+	}
+
+	for _, entry := range entries {
+		day, _, ok := strings.Cut(entry.Name(), ".")
+		if !ok || entry.IsDir() || day >= cutoff {
+			continue
+		}
+
+		if _, err := time.Parse(TRACK_DAY_FORMAT, day); err != nil {
+			continue
+		}
+
+		err = os.Remove(filepath.Join(ts.Tracks.Dir, entry.Name()))
+		if err != nil {
+			fmt.Printf("track store prune failed: %s\n", err.Error())
+		}
+	}
+}
+
+func (ts *TrackStore) segmentName(day string) string {
+	return filepath.Join(ts.Tracks.Dir, day+TRACK_SUFFIX)
+}
+
+func (ts *TrackStore) indexName(day string) string {
+	return filepath.Join(ts.Tracks.Dir, day+TRACK_INDEX_SUFFIX)
+}
+
+func newTrackIndex() *trackIndex {
+	return &trackIndex{
+		Ships: map[int][]uint32{},
+		Cells: map[uint32]map[int]struct{}{},
+		Last:  map[int]int64{},
+	}
+}
+
+// add indexes the next record in the segment.
+func (ti *trackIndex) add(mmsi int, h History) {
+	ti.Ships[mmsi] = append(ti.Ships[mmsi], ti.Count)
+	ti.Last[mmsi] = h.Timestamp
+	ti.Count++
+
+	cell := trackCell(h.LatLon)
+	if _, ok := ti.Cells[cell]; !ok {
+		ti.Cells[cell] = map[int]struct{}{}
+	}
+	ti.Cells[cell][mmsi] = struct{}{}
+}
+
+// scanTrackSegment builds the index of a segment from its complete records.
+func scanTrackSegment(name string) (*trackIndex, error) {
+	index := newTrackIndex()
+
+	f, err := os.Open(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return index, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not open track segment: %w", err)
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	b := make([]byte, TRACK_RECORD_BYTES)
+
+	for {
+		_, err := io.ReadFull(r, b)
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return index, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not read track segment: %w", err)
+		}
+
+		index.add(decodeTrackRecord(b))
+	}
+}
+
+// writeTrackIndex writes the number of ships, then each mmsi followed by its record count and record numbers,
+// then the number of cells, then each cell followed by its ship count and mmsis.
+// The index is written to a temporary file and renamed into place so a crash never leaves a truncated index.
+func writeTrackIndex(name string, index *trackIndex) error {
+	dir := filepath.Dir(name)
+	f, err := os.CreateTemp(dir, filepath.Base(name)+"*.tmp")
+	if err != nil {
+		return fmt.Errorf("could not create temporary track index: %w", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+
+	err = binary.Write(w, binary.LittleEndian, uint32(len(index.Ships)))
+	if err != nil {
+		return fmt.Errorf("could not write track index: %w", err)
+	}
+
+	for mmsi, offsets := range index.Ships {
+		err = binary.Write(w, binary.LittleEndian, [2]uint32{uint32(mmsi), uint32(len(offsets))})
+		if err != nil {
+			return fmt.Errorf("could not write track index: %w", err)
+		}
+
+		err = binary.Write(w, binary.LittleEndian, offsets)
+		if err != nil {
+			return fmt.Errorf("could not write track index: %w", err)
+		}
+	}
+
+	err = binary.Write(w, binary.LittleEndian, uint32(len(index.Cells)))
+	if err != nil {
+		return fmt.Errorf("could not write track index: %w", err)
+	}
+
+	for cell, ships := range index.Cells {
+		err = binary.Write(w, binary.LittleEndian, [2]uint32{cell, uint32(len(ships))})
+		if err != nil {
+			return fmt.Errorf("could not write track index: %w", err)
+		}
+
+		mmsis := make([]uint32, 0, len(ships))
+		for mmsi := range ships {
+			mmsis = append(mmsis, uint32(mmsi))
+		}
+
+		err = binary.Write(w, binary.LittleEndian, mmsis)
+		if err != nil {
+			return fmt.Errorf("could not write track index: %w", err)
+		}
+	}
+
+	err = w.Flush()
+	if err != nil {
+		return fmt.Errorf("could not flush track index: %w", err)
+	}
+
+	err = f.Sync()
+	if err != nil {
+		return fmt.Errorf("could not sync track index: %w", err)
+	}
+
+	err = f.Close()
+	if err != nil {
+		return fmt.Errorf("could not close track index: %w", err)
+	}
+
+	err = os.Rename(f.Name(), name)
+	if err != nil {
+		return fmt.Errorf("could not rename track index: %w", err)
+	}
+
+	return syncDir(dir)
+}
+
+func readTrackIndex(r io.Reader) (*trackIndex, error) {
+	index := newTrackIndex()
+
+	var ships uint32
+	err := binary.Read(r, binary.LittleEndian, &ships)
+	if err != nil {
+		return nil, fmt.Errorf("could not read track index: %w", err)
+	}
+
+	for i := uint32(0); i < ships; i++ {
+		var header [2]uint32
+		err = binary.Read(r, binary.LittleEndian, &header)
+		if err != nil {
+			return nil, fmt.Errorf("could not read track index: %w", err)
+		}
+
+		offsets := make([]uint32, header[1])
+		err = binary.Read(r, binary.LittleEndian, offsets)
+		if err != nil {
+			return nil, fmt.Errorf("could not read track index: %w", err)
+		}
+		index.Ships[int(header[0])] = offsets
+	}
+
+	var cells uint32
+	err = binary.Read(r, binary.LittleEndian, &cells)
+	if err != nil {
+		return nil, fmt.Errorf("could not read track index: %w", err)
+	}
+
+	for i := uint32(0); i < cells; i++ {
+		var header [2]uint32
+		err = binary.Read(r, binary.LittleEndian, &header)
+		if err != nil {
+			return nil, fmt.Errorf("could not read track index: %w", err)
+		}
+
+		mmsis := make([]uint32, header[1])
+		err = binary.Read(r, binary.LittleEndian, mmsis)
+		if err != nil {
+			return nil, fmt.Errorf("could not read track index: %w", err)
+		}
+
+		index.Cells[header[0]] = map[int]struct{}{}
+		for _, mmsi := range mmsis {
+			index.Cells[header[0]][int(mmsi)] = struct{}{}
+		}
+	}
+
+	return index, nil
+}
+
+// trackCell returns the TRACK_CELL_DEGREES grid cell containing latLon.
+func trackCell(latLon []float64) uint32 {
+	cols := uint32(360 / TRACK_CELL_DEGREES)
+	row := uint32(min(math.Floor((latLon[0]-LATMIN)/TRACK_CELL_DEGREES), 180/TRACK_CELL_DEGREES-1))
+	col := uint32(min(math.Floor((latLon[1]-LNGMIN)/TRACK_CELL_DEGREES), 360/TRACK_CELL_DEGREES-1))
+	return row*cols + col
+}
+
+// trackCellsInBbox returns every grid cell overlapping bbox.
+func trackCellsInBbox(bbox [2][2]float64) []uint32 {
+	cols := uint32(360 / TRACK_CELL_DEGREES)
+
+	cells := []uint32{}
+	for _, b := range splitBbox(bbox) {
+		sw := trackCell([]float64{b[0][0], b[0][1]})
+		ne := trackCell([]float64{b[1][0], b[1][1]})
+		for row := sw / cols; row <= ne/cols; row++ {
+			for col := sw % cols; col <= ne%cols; col++ {
+				cells = append(cells, row*cols+col)
+			}
+		}
+	}
+
+	return cells
+}
+
+func encodeTrackRecord(mmsi int, latLon []float64, timestamp int64) []byte {
+	b := make([]byte, TRACK_RECORD_BYTES)
+	binary.LittleEndian.PutUint32(b[0:4], uint32(mmsi))
+	binary.LittleEndian.PutUint64(b[4:12], uint64(timestamp))
+	binary.LittleEndian.PutUint32(b[12:16], uint32(int32(math.Round(latLon[0]*TRACK_SCALE))))
+	binary.LittleEndian.PutUint32(b[16:20], uint32(int32(math.Round(latLon[1]*TRACK_SCALE))))
+	return b
+}
+
+func decodeTrackRecord(b []byte) (int, History) {
+	mmsi := int(binary.LittleEndian.Uint32(b[0:4]))
+	h := History{
+		Timestamp: int64(binary.LittleEndian.Uint64(b[4:12])),
+		LatLon: []float64{
+			float64(int32(binary.LittleEndian.Uint32(b[12:16]))) / TRACK_SCALE,
+			float64(int32(binary.LittleEndian.Uint32(b[16:20]))) / TRACK_SCALE,
+		},
+	}
+	return mmsi, h
+}
+
+// trackRetainFrom returns the start of the oldest day kept by a track store retaining retainDays, or 0 when days are never pruned.
+func trackRetainFrom(retainDays int) int64 {
+	if retainDays < 1 {
+		return 0
+	}
+	return time.Now().UTC().AddDate(0, 0, -retainDays).Truncate(24 * time.Hour).Unix()
+}
+
+// trackDays returns the UTC days spanned by from and to, oldest first.
+// from is clamped to the retention window and to to now, so ranges reaching past either do not walk days that cannot hold positions.
+func trackDays(from int64, to int64, retainDays int) []string {
+	days := []string{}
+	from = max(from, trackRetainFrom(retainDays))
+	to = min(to, time.Now().Unix())
+	if to < from {
+		return days
+	}
+
+	start := time.Unix(from, 0).UTC().Truncate(24 * time.Hour)
+	end := time.Unix(to, 0).UTC()
+	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+		days = append(days, d.Format(TRACK_DAY_FORMAT))
+	}
+
+	return days
+}
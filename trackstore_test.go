@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestTrackStoreRebuildsCorruptIndex(t *testing.T) {
+	dir := t.TempDir()
+	ts := NewTrackStore(Tracks{Enable: true, Dir: dir, RetainDays: 90})
+	err := ts.Open()
+	if err != nil {
+		t.Fatalf("Open failed: %s", err.Error())
+	}
+	defer ts.Close()
+
+	day := time.Now().UTC().AddDate(0, 0, -1).Format(TRACK_DAY_FORMAT)
+	start, _ := time.Parse(TRACK_DAY_FORMAT, day)
+
+	records := []byte{}
+	want := newTrackIndex()
+	for i, p := range []struct {
+		mmsi   int
+		latLon []float64
+	}{
+		{1, []float64{51.9, 4.1}},
+		{2, []float64{-33.9, 151.2}},
+		{1, []float64{51.95, 4.0}},
+	} {
+		timestamp := start.Unix() + int64(i)*60
+		records = append(records, encodeTrackRecord(p.mmsi, p.latLon, timestamp)...)
+		want.add(p.mmsi, NewHistory(p.latLon, timestamp))
+	}
+
+	err = os.WriteFile(ts.segmentName(day), records, 0o644)
+	if err != nil {
+		t.Fatalf("could not write segment: %s", err.Error())
+	}
+
+	err = writeTrackIndex(ts.indexName(day), want)
+	if err != nil {
+		t.Fatalf("writeTrackIndex failed: %s", err.Error())
+	}
+
+	valid, err := os.ReadFile(ts.indexName(day))
+	if err != nil {
+		t.Fatalf("could not read index: %s", err.Error())
+	}
+
+	tests := []struct {
+		name  string
+		index []byte
+	}{
+		{name: "valid", index: valid},
+		{name: "missing", index: nil},
+		{name: "truncated", index: valid[:len(valid)/2]},
+		{name: "empty", index: []byte{}},
+		{name: "garbage", index: []byte{0xff, 0xff, 0xff, 0xff, 1, 2, 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Remove(ts.indexName(day))
+			if tt.index != nil {
+				err := os.WriteFile(ts.indexName(day), tt.index, 0o644)
+				if err != nil {
+					t.Fatalf("could not write index: %s", err.Error())
+				}
+			}
+
+			index, err := ts.loadIndex(day)
+			if err != nil {
+				t.Fatalf("loadIndex failed: %s", err.Error())
+			}
+
+			for mmsi, offsets := range want.Ships {
+				if !slices.Equal(index.Ships[mmsi], offsets) {
+					t.Errorf("offsets of %d = %v, want %v", mmsi, index.Ships[mmsi], offsets)
+				}
+			}
+
+			for cell, ships := range want.Cells {
+				if len(index.Cells[cell]) != len(ships) {
+					t.Errorf("cell %d has %d ships, want %d", cell, len(index.Cells[cell]), len(ships))
+				}
+			}
+
+			// A rebuilt index is written back for the next query.
+			f, err := os.Open(ts.indexName(day))
+			if err != nil {
+				t.Fatalf("could not open index: %s", err.Error())
+			}
+			defer f.Close()
+
+			written, err := readTrackIndex(bufio.NewReader(f))
+			if err != nil {
+				t.Fatalf("readTrackIndex failed: %s", err.Error())
+			}
+
+			for mmsi, offsets := range want.Ships {
+				if !slices.Equal(written.Ships[mmsi], offsets) {
+					t.Errorf("written offsets of %d = %v, want %v", mmsi, written.Ships[mmsi], offsets)
+				}
+			}
+		})
+	}
+
+	// Days that have not closed may still be appended to, so no index is written for them.
+	tomorrow := time.Now().UTC().AddDate(0, 0, 1).Format(TRACK_DAY_FORMAT)
+	_, err = ts.loadIndex(tomorrow)
+	if err != nil {
+		t.Fatalf("loadIndex failed: %s", err.Error())
+	}
+
+	_, err = os.Stat(ts.indexName(tomorrow))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("index written for %s, want none", tomorrow)
+	}
+}
+
+func TestTrackDaysRetention(t *testing.T) {
+	now := time.Now().Unix()
+
+	tests := []struct {
+		name       string
+		from       int64
+		to         int64
+		retainDays int
+		want       int
+	}{
+		{name: "from zero is clamped", from: 0, to: now, retainDays: 3, want: 4},
+		{name: "within retention", from: now - 86400, to: now, retainDays: 3, want: 2},
+		{name: "no retention limit", from: now - 10*86400, to: now, retainDays: 0, want: 11},
+		{name: "to before from", from: now, to: now - 86400, retainDays: 3, want: 0},
+		{name: "before retention", from: 0, to: 86400, retainDays: 3, want: 0},
+		{name: "far future to", from: now - 86400, to: 9000000000000, retainDays: 3, want: 2},
+		{name: "future range", from: now + 86400, to: now + 10*86400, retainDays: 3, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := trackDays(tt.from, tt.to, tt.retainDays)
+			if len(got) != tt.want {
+				t.Errorf("trackDays(%d, %d, %d) = %v, want %d days", tt.from, tt.to, tt.retainDays, got, tt.want)
+			}
+		})
+	}
+}
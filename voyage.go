@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Voyage configures how a ship's history is segmented into voyages.
+// A stop is recorded when a ship remains within StopRadiusNm for at least StopMinutes.
+// Voyages shorter than MinDistanceNm, such as berth shifts, are discarded.
+// Stops are named after the nearest port within PortRadiusNm, zero disables port lookup.
+type Voyage struct {
+	StopMinutes   int     `json:"stopMinutes"`
+	StopRadiusNm  float64 `json:"stopRadiusNm"`
+	MinDistanceNm float64 `json:"minDistanceNm"`
+	PortRadiusNm  float64 `json:"portRadiusNm"`
+}
+
+// ShipVoyage is a single leg of a ship's history bounded by stops.
+// Partial is set when the origin is the start of recorded history rather than an observed stop.
+// Underway is set when the ship has not yet stopped at its destination, in which case Arrival is 0.
+// OriginPort and DestinationPort are the UN/LOCODEs of the ports stopped at, empty when no port is close or the end is not a stop.
+type ShipVoyage struct {
+	Origin          []float64 `json:"origin"`
+	Destination     []float64 `json:"destination"`
+	OriginPort      string    `json:"originPort"`
+	DestinationPort string    `json:"destinationPort"`
+	Departure       int64     `json:"departure"`
+	Arrival         int64     `json:"arrival"`
+	DistanceNm      float64   `json:"distanceNm"`
+	AvgSpeed        float64   `json:"avgSpeed"`
+	Points          int       `json:"points"`
+	Partial         bool      `json:"partial"`
+	Underway        bool      `json:"underway"`
+}
+
+// stop is a run of history points, indexed oldest first, that lie within the stop radius of the first point.
+type stop struct {
+	first int
+	last  int
+}
+
+func NewVoyageDefaults() Voyage {
+	return Voyage{
+		StopMinutes:   60,
+		StopRadiusNm:  0.5,
+		MinDistanceNm: 2,
+		PortRadiusNm:  10,
+	}
+}
+
+// GetShipVoyages segments the ship's history into voyages, returned newest first to match GetShipHistory.
+func (s *Ships) GetShipVoyages(mmsi int, v Voyage) ([]ShipVoyage, error) {
+	s.HistoryLock.RLock()
+	history, ok := s.History[mmsi]
+	if !ok {
+		s.HistoryLock.RUnlock()
+		return nil, fmt.Errorf("mmsi does not exist in ship history")
+	}
+
+	// History is stored newest first, segmentation walks it oldest first.
+	points := history.Points()
+	s.HistoryLock.RUnlock()
+	slices.Reverse(points)
+
+	voyages := v.segment(points)
+	slices.Reverse(voyages)
+
+	return voyages, nil
+}
+
+// segment splits chronologically ordered points into voyages between stops.
+func (v Voyage) segment(points []History) []ShipVoyage {
+	voyages := make([]ShipVoyage, 0)
+	if len(points) < 2 {
+		return voyages
+	}
+
+	stops := v.stops(points)
+
+	// Departure index and whether it is a real stop or the start of recorded history.
+	depart := 0
+	partial := true
+	if len(stops) > 0 && stops[0].first == 0 {
+		depart = stops[0].last
+		partial = false
+		stops = stops[1:]
+	}
+
+	for _, st := range stops {
+		voyage := newShipVoyage(points, depart, st.first)
+		voyage.Partial = partial
+		voyage.DestinationPort = nearestPort(voyage.Destination, v.PortRadiusNm)
+		if !partial {
+			voyage.OriginPort = nearestPort(voyage.Origin, v.PortRadiusNm)
+		}
+		if voyage.DistanceNm >= v.MinDistanceNm {
+			voyages = append(voyages, voyage)
+		}
+
+		depart = st.last
+		partial = false
+	}
+
+	if depart < len(points)-1 {
+		voyage := newShipVoyage(points, depart, len(points)-1)
+		voyage.Partial = partial
+		voyage.Underway = true
+		voyage.Arrival = 0
+		if !partial {
+			voyage.OriginPort = nearestPort(voyage.Origin, v.PortRadiusNm)
+		}
+		if voyage.DistanceNm >= v.MinDistanceNm {
+			voyages = append(voyages, voyage)
+		}
+	}
+
+	return voyages
+}
+
+// stops returns every run of points that stayed within StopRadiusNm for at least StopMinutes.
+func (v Voyage) stops(points []History) []stop {
+	stops := []stop{}
+
+	first := 0
+	for i := 1; i <= len(points); i++ {
+		if i < len(points) && distanceNm(points[first].LatLon, points[i].LatLon) <= v.StopRadiusNm {
+			continue
+		}
+
+		last := i - 1
+		if points[last].Timestamp-points[first].Timestamp >= int64(v.StopMinutes*60) {
+			stops = append(stops, stop{first: first, last: last})
+		}
+		first = i
+	}
+
+	return stops
+}
+
+func newShipVoyage(points []History, depart int, arrive int) ShipVoyage {
+	voyage := ShipVoyage{
+		Origin:      points[depart].LatLon,
+		Destination: points[arrive].LatLon,
+		Departure:   points[depart].Timestamp,
+		Arrival:     points[arrive].Timestamp,
+		Points:      arrive - depart + 1,
+	}
+
+	for i := depart + 1; i <= arrive; i++ {
+		voyage.DistanceNm += distanceNm(points[i-1].LatLon, points[i].LatLon)
+	}
+
+	hours := float64(voyage.Arrival-voyage.Departure) / 3600
+	if hours > 0 {
+		voyage.AvgSpeed = voyage.DistanceNm / hours
+	}
+
+	return voyage
+}
+
+// nearestPort returns the UN/LOCODE of the port in Ports closest to latLon within radiusNm, or an empty string when there is none.
+func nearestPort(latLon []float64, radiusNm float64) string {
+	if radiusNm <= 0 || len(latLon) != 2 {
+		return ""
+	}
+
+	nearest := ""
+	nearestNm := radiusNm
+	for locode, port := range Ports {
+		d := distanceNm(latLon, port.LatLon)
+		if d < nearestNm || (d == nearestNm && (nearest == "" || locode < nearest)) {
+			nearest = locode
+			nearestNm = d
+		}
+	}
+
+	return nearest
+}
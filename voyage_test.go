@@ -0,0 +1,62 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestVoyagePorts(t *testing.T) {
+	rotterdam := []float64{51.96, 4.05}
+	antwerp := []float64{51.27, 4.35}
+	northSea := []float64{52.6, 3.0}
+	v := NewVoyageDefaults()
+
+	// stay returns two points an hour apart at latLon, a stop under the default voyage config.
+	stay := func(latLon []float64, from int64) []History {
+		return []History{NewHistory(latLon, from), NewHistory(latLon, from+3600)}
+	}
+
+	tests := []struct {
+		name   string
+		points []History
+		want   [][2]string
+	}{
+		{
+			name:   "port to port",
+			points: slices.Concat(stay(rotterdam, 0), stay(antwerp, 10000)),
+			want:   [][2]string{{"NLRTM", "BEANR"}},
+		},
+		{
+			name:   "port to anchorage",
+			points: slices.Concat(stay(rotterdam, 0), stay(northSea, 10000)),
+			want:   [][2]string{{"NLRTM", ""}},
+		},
+		{
+			name:   "start of history",
+			points: slices.Concat([]History{NewHistory(northSea, 0)}, stay(rotterdam, 10000)),
+			want:   [][2]string{{"", "NLRTM"}},
+		},
+		{
+			name:   "underway",
+			points: slices.Concat(stay(rotterdam, 0), []History{NewHistory(antwerp, 10000)}),
+			want:   [][2]string{{"NLRTM", ""}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := [][2]string{}
+			for _, voyage := range v.segment(tt.points) {
+				got = append(got, [2]string{voyage.OriginPort, voyage.DestinationPort})
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ports = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if port := nearestPort(northSea, v.PortRadiusNm); port != "" {
+		t.Errorf("nearestPort(%v) = %q, want no port", northSea, port)
+	}
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	WAL_PREFIX        = "wal-"
+	WAL_SUFFIX        = ".log"
+	WAL_HEADER_BYTES  = 16
+	WAL_MAX_RECORD    = 1 << 20
+	WAL_SEGMENT_BYTES = 1 << 20
+)
+
+// Wal configures the write-ahead log of accepted ship updates.
+// Records are buffered and synced to disk every SyncMs milliseconds, bounding data loss on crash to that interval.
+// Segments are rotated once they exceed SegmentMB and removed once a snapshot covers them.
+// The dock refuses to start with the wal enabled and snapshots disabled, as nothing would remove segments.
+type Wal struct {
+	Enable    bool   `json:"enable"`
+	Dir       string `json:"dir"`
+	SegmentMB int    `json:"segmentMB"`
+	SyncMs    int    `json:"syncMs"`
+}
+
+// WriteAheadLog appends raw aisstream packets and their receive time to segmented log files.
+// Each record is laid out as length (4 bytes), crc32 of the payload (4 bytes), unix timestamp (8 bytes), then the payload.
+type WriteAheadLog struct {
+	Wal     Wal
+	Lock    sync.Mutex
+	Segment uint64
+	file    *os.File
+	writer  *bufio.Writer
+	size    int64
+	Quit    chan struct{}
+	Done    chan struct{}
+}
+
+// WalRecord is a single replayable ship update.
+type WalRecord struct {
+	Timestamp int64
+	Payload   []byte
+}
+
+func NewWalDefaults() Wal {
+	return Wal{
+		Enable:    false,
+		Dir:       "./wal",
+		SegmentMB: 64,
+		SyncMs:    1000,
+	}
+}
+
+func NewWriteAheadLog(w Wal) *WriteAheadLog {
+	return &WriteAheadLog{
+		Wal:  w,
+		Quit: make(chan struct{}),
+		Done: make(chan struct{}),
+	}
+}
+
+// Open creates the log directory and starts a new segment after the newest existing one.
+func (wal *WriteAheadLog) Open() error {
+	if !wal.Wal.Enable {
+		return nil
+	}
+
+	err := os.MkdirAll(wal.Wal.Dir, 0o755)
+	if err != nil {
+		return fmt.Errorf("could not create wal dir: %w", err)
+	}
+
+	segments, err := listWalSegments(wal.Wal.Dir)
+	if err != nil {
+		return err
+	}
+
+	wal.Lock.Lock()
+	defer wal.Lock.Unlock()
+
+	if len(segments) > 0 {
+		wal.Segment = segments[len(segments)-1]
+	}
+
+	return wal.openSegment(wal.Segment + 1)
+}
+
+// Run syncs buffered records to disk every SyncMs milliseconds until quit, then closes the current segment.
+func (wal *WriteAheadLog) Run() {
+	if !wal.Wal.Enable {
+		<-wal.Quit
+		wal.Done <- struct{}{}
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(max(wal.Wal.SyncMs, 1)) * time.Millisecond)
+
+	for {
+		select {
+		case <-ticker.C:
+			err := wal.Sync()
+			if err != nil {
+				fmt.Printf("wal sync failed: %s\n", err.Error())
+			}
+		case <-wal.Quit:
+			err := wal.Close()
+			if err != nil {
+				fmt.Printf("wal close failed: %s\n", err.Error())
+			}
+			wal.Done <- struct{}{}
+			return
+		}
+	}
+}
+
+// Append buffers a record in the current segment, rotating to a new segment once SegmentMB is exceeded.
+func (wal *WriteAheadLog) Append(timestamp int64, payload []byte) error {
+	if !wal.Wal.Enable {
+		return nil
+	}
+
+	wal.Lock.Lock()
+	defer wal.Lock.Unlock()
+
+	if wal.writer == nil {
+		return fmt.Errorf("wal segment is not open")
+	}
+
+	header := make([]byte, WAL_HEADER_BYTES)
+	binary.LittleEndian.PutUint32(header[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(header[4:8], crc32.ChecksumIEEE(payload))
+	binary.LittleEndian.PutUint64(header[8:16], uint64(timestamp))
+
+	_, err := wal.writer.Write(header)
+	if err != nil {
+		return fmt.Errorf("could not write wal header: %w", err)
+	}
+
+	_, err = wal.writer.Write(payload)
+	if err != nil {
+		return fmt.Errorf("could not write wal payload: %w", err)
+	}
+
+	wal.size += int64(WAL_HEADER_BYTES + len(payload))
+	if wal.size >= int64(max(wal.Wal.SegmentMB, 1))*WAL_SEGMENT_BYTES {
+		_, err = wal.rotate()
+	}
+
+	return err
+}
+
+// Rotate closes the current segment and opens the next one, returning the new segment number.
+// Every record appended before Rotate returns lives in a segment older than the returned number.
+func (wal *WriteAheadLog) Rotate() (uint64, error) {
+	if !wal.Wal.Enable {
+		return 0, nil
+	}
+
+	wal.Lock.Lock()
+	defer wal.Lock.Unlock()
+
+	return wal.rotate()
+}
+
+func (wal *WriteAheadLog) rotate() (uint64, error) {
+	err := wal.closeSegment()
+	if err != nil {
+		return 0, err
+	}
+
+	err = wal.openSegment(wal.Segment + 1)
+	if err != nil {
+		return 0, err
+	}
+
+	return wal.Segment, nil
+}
+
+// Compact removes every segment older than segment.
+func (wal *WriteAheadLog) Compact(segment uint64) error {
+	if !wal.Wal.Enable {
+		return nil
+	}
+
+	segments, err := listWalSegments(wal.Wal.Dir)
+	if err != nil {
+		return err
+	}
+
+	for _, seg := range segments {
+		if seg >= segment {
+			break
+		}
+
+		err = os.Remove(walSegmentName(wal.Wal.Dir, seg))
+		if err != nil {
+			return fmt.Errorf("could not remove wal segment: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (wal *WriteAheadLog) Sync() error {
+	wal.Lock.Lock()
+	defer wal.Lock.Unlock()
+
+	if wal.writer == nil {
+		return nil
+	}
+
+	err := wal.writer.Flush()
+	if err != nil {
+		return fmt.Errorf("could not flush wal: %w", err)
+	}
+
+	return wal.file.Sync()
+}
+
+func (wal *WriteAheadLog) Close() error {
+	wal.Lock.Lock()
+	defer wal.Lock.Unlock()
+
+	return wal.closeSegment()
+}
+
+func (wal *WriteAheadLog) openSegment(segment uint64) error {
+	f, err := os.OpenFile(walSegmentName(wal.Wal.Dir, segment), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("could not open wal segment: %w", err)
+	}
+
+	wal.Segment = segment
+	wal.file = f
+	wal.writer = bufio.NewWriter(f)
+	wal.size = 0
+
+	return syncDir(wal.Wal.Dir)
+}
+
+func (wal *WriteAheadLog) closeSegment() error {
+	if wal.writer == nil {
+		return nil
+	}
+
+	err := wal.writer.Flush()
+	if err != nil {
+		return fmt.Errorf("could not flush wal segment: %w", err)
+	}
+
+	err = wal.file.Sync()
+	if err != nil {
+		return fmt.Errorf("could not sync wal segment: %w", err)
+	}
+
+	err = wal.file.Close()
+	if err != nil {
+		return fmt.Errorf("could not close wal segment: %w", err)
+	}
+
+	wal.file = nil
+	wal.writer = nil
+
+	return nil
+}
+
+// ReplayWal calls apply for every record in segments at or after segment, in the order they were written.
+// A torn or corrupt record ends replay of its segment, as it can only be the tail written during a crash.
+func ReplayWal(dir string, segment uint64, apply func(WalRecord)) (int, error) {
+	segments, err := listWalSegments(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, seg := range segments {
+		if seg < segment {
+			continue
+		}
+
+		n, err := replayWalSegment(walSegmentName(dir, seg), apply)
+		count += n
+		if err != nil {
+			fmt.Printf("wal segment %d truncated after %d records: %s\n", seg, n, err.Error())
+		}
+	}
+
+	return count, nil
+}
+
+func replayWalSegment(name string, apply func(WalRecord)) (int, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return 0, fmt.Errorf("could not open wal segment: %w", err)
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	header := make([]byte, WAL_HEADER_BYTES)
+
+	count := 0
+	for {
+		_, err := io.ReadFull(r, header)
+		if errors.Is(err, io.EOF) {
+			return count, nil
+		}
+		if err != nil {
+			return count, fmt.Errorf("could not read wal header: %w", err)
+		}
+
+		length := binary.LittleEndian.Uint32(header[0:4])
+		if length > WAL_MAX_RECORD {
+			return count, fmt.Errorf("wal record length %d exceeds maximum", length)
+		}
+
+		payload := make([]byte, length)
+		_, err = io.ReadFull(r, payload)
+		if err != nil {
+			return count, fmt.Errorf("could not read wal payload: %w", err)
+		}
+
+		if crc32.ChecksumIEEE(payload) != binary.LittleEndian.Uint32(header[4:8]) {
+			return count, fmt.Errorf("wal record checksum mismatch")
+		}
+
+		apply(WalRecord{
+			Timestamp: int64(binary.LittleEndian.Uint64(header[8:16])),
+			Payload:   payload,
+		})
+		count++
+	}
+}
+
+// listWalSegments returns the segment numbers found in dir in ascending order.
+func listWalSegments(dir string) ([]uint64, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []uint64{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read wal dir: %w", err)
+	}
+
+	segments := []uint64{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, WAL_PREFIX) || !strings.HasSuffix(name, WAL_SUFFIX) {
+			continue
+		}
+
+		seg, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, WAL_PREFIX), WAL_SUFFIX), 10, 64)
+		if err != nil {
+			continue
+		}
+		segments = append(segments, seg)
+	}
+
+	slices.Sort(segments)
+
+	return segments, nil
+}
+
+func walSegmentName(dir string, segment uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("%s%020d%s", WAL_PREFIX, segment, WAL_SUFFIX))
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"testing"
+)
+
+func TestReplayWal(t *testing.T) {
+	// Every case writes records 1-3 to the first segment and 4-5 to the second, then damages the log with modify.
+	tests := []struct {
+		name    string
+		segment uint64
+		modify  func(wal *WriteAheadLog, last string) error
+		want    []int64
+	}{
+		{
+			name: "intact",
+			want: []int64{1, 2, 3, 4, 5},
+		},
+		{
+			name:    "from segment",
+			segment: 2,
+			want:    []int64{4, 5},
+		},
+		{
+			name: "torn tail",
+			modify: func(wal *WriteAheadLog, last string) error {
+				info, err := os.Stat(last)
+				if err != nil {
+					return err
+				}
+				return os.Truncate(last, info.Size()-3)
+			},
+			want: []int64{1, 2, 3, 4},
+		},
+		{
+			name: "torn header",
+			modify: func(wal *WriteAheadLog, last string) error {
+				f, err := os.OpenFile(last, os.O_WRONLY|os.O_APPEND, 0o644)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				_, err = f.Write([]byte{1, 2, 3})
+				return err
+			},
+			want: []int64{1, 2, 3, 4, 5},
+		},
+		{
+			name: "checksum mismatch",
+			modify: func(wal *WriteAheadLog, last string) error {
+				b, err := os.ReadFile(last)
+				if err != nil {
+					return err
+				}
+				b[len(b)-1] ^= 0xff
+				return os.WriteFile(last, b, 0o644)
+			},
+			want: []int64{1, 2, 3, 4},
+		},
+		{
+			name: "compacted",
+			modify: func(wal *WriteAheadLog, last string) error {
+				return wal.Compact(2)
+			},
+			want: []int64{4, 5},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wal := NewWriteAheadLog(Wal{Enable: true, Dir: t.TempDir(), SegmentMB: 1})
+			err := wal.Open()
+			if err != nil {
+				t.Fatalf("Open failed: %s", err.Error())
+			}
+
+			for ts := int64(1); ts <= 5; ts++ {
+				if ts == 4 {
+					_, err = wal.Rotate()
+					if err != nil {
+						t.Fatalf("Rotate failed: %s", err.Error())
+					}
+				}
+
+				err = wal.Append(ts, []byte(fmt.Sprintf("record %d", ts)))
+				if err != nil {
+					t.Fatalf("Append failed: %s", err.Error())
+				}
+			}
+
+			last := walSegmentName(wal.Wal.Dir, wal.Segment)
+			err = wal.Close()
+			if err != nil {
+				t.Fatalf("Close failed: %s", err.Error())
+			}
+
+			if tt.modify != nil {
+				err = tt.modify(wal, last)
+				if err != nil {
+					t.Fatalf("could not modify wal: %s", err.Error())
+				}
+			}
+
+			got := []int64{}
+			n, err := ReplayWal(wal.Wal.Dir, tt.segment, func(r WalRecord) {
+				if string(r.Payload) != fmt.Sprintf("record %d", r.Timestamp) {
+					t.Errorf("record %d has payload %q", r.Timestamp, r.Payload)
+				}
+				got = append(got, r.Timestamp)
+			})
+			if err != nil {
+				t.Fatalf("ReplayWal failed: %s", err.Error())
+			}
+
+			if n != len(got) || !slices.Equal(got, tt.want) {
+				t.Errorf("ReplayWal(%d) = %d records %v, want %v", tt.segment, n, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import "fmt"
+
+// GetShipsInPolygon returns the ships inside polygon, a ring of lat, lon vertices.
+// Candidates are gathered from the geocache using the polygon's bbox then tested exactly.
+func (s *Ships) GetShipsInPolygon(polygon [][]float64) ([]*State, error) {
+	if len(polygon) < 3 {
+		return nil, fmt.Errorf("polygon must have at least 3 vertices")
+	}
+
+	candidates, err := s.GetShipsInBox(polygonBbox(polygon))
+	if err != nil {
+		return nil, err
+	}
+
+	ships := make([]*State, 0)
+
+	s.StateLock.RLock()
+	for _, ship := range candidates {
+		if pointInPolygon(ship.LatLon, polygon) {
+			ships = append(ships, ship)
+		}
+	}
+	s.StateLock.RUnlock()
+
+	return ships, nil
+}
+
+// GetShipsInRadius returns the ships within radiusNm great-circle distance of centre.
+// Candidates are gathered from the geocache using the bbox enclosing the circle then tested exactly.
+func (s *Ships) GetShipsInRadius(centre []float64, radiusNm float64) ([]*State, error) {
+	if radiusNm <= 0 {
+		return nil, fmt.Errorf("radius must be greater than 0")
+	}
+
+	if !validBbox([2][2]float64{{centre[0], centre[1]}, {centre[0], centre[1]}}) {
+		return nil, fmt.Errorf("centre out of range")
+	}
+
+	candidates, err := s.GetShipsInBox(radiusBbox(centre, radiusNm))
+	if err != nil {
+		return nil, err
+	}
+
+	ships := make([]*State, 0)
+
+	s.StateLock.RLock()
+	for _, ship := range candidates {
+		if distanceNm(centre, ship.LatLon) <= radiusNm {
+			ships = append(ships, ship)
+		}
+	}
+	s.StateLock.RUnlock()
+
+	return ships, nil
+}